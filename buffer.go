@@ -0,0 +1,57 @@
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+// BufferQueue 支持将数据读取到调用方提供的缓冲区，缓冲区容量足够时不分配内存，用于高吞吐的消费方复用内存
+type BufferQueue interface {
+	Queue
+	// GetInto 将数据写入 dst[:0] 并返回，dst 容量不足时分配新的切片，返回值与 dst 可能不共享底层数组
+	GetInto(ctx context.Context, dst []byte) ([]byte, error)
+}
+
+// GetInto queue 实现了 BufferQueue 时调用其 GetInto，否则调用 Get 后复制到 dst，dst 为 nil 时直接返回 Get 的结果
+func GetInto(ctx context.Context, queue Queue, dst []byte) ([]byte, error) {
+	if q, ok := queue.(BufferQueue); ok {
+		return q.GetInto(ctx, dst)
+	}
+	data, err := queue.Get(ctx)
+	if err != nil || dst == nil {
+		return data, err
+	}
+	buf := grow(dst, len(data))
+	copy(buf, data)
+	return buf, nil
+}
+
+// 返回长度为 n 的切片，dst 容量足够时复用 dst
+func grow(dst []byte, n int) []byte {
+	if dst == nil || cap(dst) < n {
+		return make([]byte, n)
+	}
+	return dst[:n]
+}
+
+// 超过该大小的缓冲区不放回池中，避免偶发的大数据长期占用内存
+const maxPooledBufferSize = 64 * 1024
+
+// 写入文件时使用的临时缓冲区
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
+func getBuffer(n int) *[]byte {
+	buf := bufferPool.Get().(*[]byte)
+	*buf = grow(*buf, n)
+	return buf
+}
+
+func putBuffer(buf *[]byte) {
+	if cap(*buf) <= maxPooledBufferSize {
+		bufferPool.Put(buf)
+	}
+}
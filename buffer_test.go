@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// 只实现 Queue 接口，用于测试 GetInto 的回退逻辑
+type plainQueue struct {
+	Queue
+}
+
+func TestGetInto(t *testing.T) {
+	name := "TestGetInto"
+	disk, err := NewFifoDiskQueue("fifo", WithStorage(NewMemoryStorage()))
+	if err != nil {
+		panic(err)
+	}
+	lifo, err := NewLifoDiskQueue("lifo", WithStorage(NewMemoryStorage()))
+	if err != nil {
+		panic(err)
+	}
+	for label, queue := range map[string]Queue{
+		"FifoMemoryQueue":   NewFifoMemoryQueue(8),
+		"LifoMemoryQueue":   NewLifoMemoryQueue(8),
+		"FifoDiskQueue":     disk,
+		"LifoDiskQueue":     lifo,
+		"InstrumentedQueue": NewInstrumentedQueue("instrumented", NewFifoMemoryQueue(8)),
+		"plainQueue":        plainQueue{NewFifoMemoryQueue(8)},
+	} {
+		for _, data := range []string{"data", "large data"} {
+			_ = queue.Put(nil, []byte(data))
+		}
+		dst := make([]byte, 0, 8)
+		got := map[string]bool{}
+		for i := 0; i < 2; i++ {
+			buf, err := GetInto(nil, queue, dst)
+			if err != nil {
+				t.Fatal(name, label, "读取数据", err)
+			}
+			got[string(buf)] = true
+			// 容量足够时复用 dst，不足时分配新的切片
+			if reused := &buf[0] == &dst[:1][0]; reused != (len(buf) <= cap(dst)) {
+				t.Error(name, label, "复用dst", string(buf), reused)
+			}
+		}
+		if !got["data"] || !got["large data"] {
+			t.Error(name, label, "读取全部数据", got)
+		}
+		if buf, err := GetInto(nil, queue, dst); buf != nil || err != ErrQueueEmpty {
+			t.Error(name, label, "空队列返回ErrQueueEmpty", buf, err)
+		}
+		_ = queue.Close()
+	}
+}
+
+func TestLogDiskQueueGetInto(t *testing.T) {
+	name := "TestLogDiskQueueGetInto"
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	queue, err := NewLogDiskQueue(dir + "/log")
+	if err != nil {
+		panic(err)
+	}
+	defer queue.Close()
+	_ = queue.Put(nil, []byte("data"))
+	group, err := queue.Group("group")
+	if err != nil {
+		panic(err)
+	}
+	dst := make([]byte, 0, 8)
+	if buf, err := group.GetInto(nil, dst); err != nil || string(buf) != "data" || &buf[0] != &dst[:1][0] {
+		t.Error(name, "消费组复用dst读取数据", string(buf), err)
+	}
+	if buf, err := queue.GetInto(nil, dst); err != nil || string(buf) != "data" || &buf[0] != &dst[:1][0] {
+		t.Error(name, "默认消费组复用dst读取数据", string(buf), err)
+	}
+}
+
+func benchmarkGet(b *testing.B, newQueue func(file string, options ...DiskOption) (Queue, error), into bool) {
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(file.Name())
+	defer os.RemoveAll(diskStateFile(file.Name()))
+	file.Close()
+	queue, err := newQueue(file.Name())
+	if err != nil {
+		panic(err)
+	}
+	defer queue.Close()
+	data := make([]byte, 1024)
+	dst := make([]byte, 0, len(data))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = queue.Put(nil, data)
+		if into {
+			dst, err = GetInto(nil, queue, dst)
+		} else {
+			_, err = queue.Get(nil)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFifoDiskQueueGet(b *testing.B) {
+	benchmarkGet(b, NewFifoDiskQueue, false)
+}
+
+func BenchmarkFifoDiskQueueGetInto(b *testing.B) {
+	benchmarkGet(b, NewFifoDiskQueue, true)
+}
+
+func BenchmarkLifoDiskQueueGet(b *testing.B) {
+	benchmarkGet(b, NewLifoDiskQueue, false)
+}
+
+func BenchmarkLifoDiskQueueGetInto(b *testing.B) {
+	benchmarkGet(b, NewLifoDiskQueue, true)
+}
@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RequeueError ToChan 退出时未被接收的数据放回队列失败，Data 为该数据，由调用方处理
+type RequeueError struct {
+	Data []byte
+	Err  error
+}
+
+func (e *RequeueError) Error() string {
+	return "queue requeue: " + e.Err.Error()
+}
+
+func (e *RequeueError) Unwrap() error {
+	return e.Err
+}
+
+// ToChan 在后台不断 Get 数据写入返回的 chan，队列关闭、ctx 失效或 Get 异常时关闭 chan。
+// ctx 失效或队列关闭时已取出但未被接收的数据会重新 Put 回队列，FIFO 队列中该数据会排到队尾，顺序随之改变。
+// 重新 Put 失败时（如队列已满或已关闭）数据以 *RequeueError 发送到返回的 error chan，不会丢失；
+// Get 返回队列关闭、ctx 失效以外的错误时，该错误发送到 error chan。
+// 队列关闭通过 StatsOf 检查，未实现 StatsQueue 的队列只在 Get 时发现关闭。
+// error chan 带缓冲，最多收到一个错误，在数据 chan 关闭后关闭，不需要时可以不读取。
+func ToChan(ctx context.Context, queue Queue) (<-chan []byte, <-chan error) {
+	ch := make(chan []byte)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(ch)
+		ticker := time.NewTicker(defaultPollInterval)
+		defer ticker.Stop()
+		for {
+			data, err := GetWait(ctx, queue, defaultPollInterval)
+			if err != nil {
+				if !errors.Is(err, ErrQueueClosed) && ctx.Err() == nil {
+					errs <- err
+				}
+				return
+			}
+			if !sendChan(ctx, queue, ch, data, ticker.C) {
+				if err := queue.Put(nil, data); err != nil {
+					errs <- &RequeueError{Data: data, Err: err}
+				}
+				return
+			}
+		}
+	}()
+	return ch, errs
+}
+
+// 等待 data 被接收，ctx 失效或队列关闭时返回 false
+func sendChan(ctx context.Context, queue Queue, ch chan<- []byte, data []byte, tick <-chan time.Time) bool {
+	for ctx.Err() == nil {
+		select {
+		case ch <- data:
+			return true
+		case <-ctx.Done():
+			return false
+		case <-tick:
+			if StatsOf(queue).Closed {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+// FromChan 将 chan 中的数据阻塞 Put 进队列，直到 chan 关闭、ctx 失效或 Put 异常。
+func FromChan(ctx context.Context, queue Queue, ch <-chan []byte) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case data, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if err := queue.Put(ctx, data); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestToChan(t *testing.T) {
+	name := "TestToChan"
+	queue := NewFifoMemoryQueue(1024)
+	for i := 0; i < 10; i++ {
+		_ = queue.Put(nil, []byte{byte(i)})
+	}
+	ch, _ := ToChan(context.Background(), queue)
+	for i := 0; i < 10; i++ {
+		if data := <-ch; data[0] != byte(i) {
+			t.Error(name, "chan按序获取数据", i, data)
+		}
+	}
+	_ = queue.Close()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error(name, "队列关闭后chan关闭")
+		}
+	case <-time.After(time.Second):
+		t.Error(name, "队列关闭后chan关闭超时")
+	}
+}
+
+func TestToChanCancel(t *testing.T) {
+	name := "TestToChanCancel"
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(file.Name())
+	defer os.RemoveAll(diskStateFile(file.Name()))
+	file.Close()
+	queue, err := NewFifoDiskQueue(file.Name())
+	if err != nil {
+		panic(err)
+	}
+	defer queue.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, errs := ToChan(ctx, queue)
+	_ = queue.Put(nil, []byte("data"))
+	time.Sleep(time.Millisecond * 50)
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Error(name, "ctx失效后chan关闭")
+	}
+	if length := queue.Len(); length != 1 {
+		t.Error(name, "ctx失效后未接收数据回到队列", length)
+	}
+	if err, ok := <-errs; ok || err != nil {
+		t.Error(name, "放回队列成功时没有错误", err)
+	}
+}
+
+func TestToChanRequeueError(t *testing.T) {
+	name := "TestToChanRequeueError"
+	queue := NewFifoMemoryQueue(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, errs := ToChan(ctx, queue)
+	_ = queue.Put(nil, []byte("taken"))
+	for queue.Len() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// 取出的数据未被接收时队列被填满，放回队列失败
+	_ = queue.Put(nil, []byte("full"))
+	cancel()
+	// 先读取 error chan，避免接收数据 chan 时数据被发送出来
+	err := <-errs
+	var requeue *RequeueError
+	if !errors.As(err, &requeue) || string(requeue.Data) != "taken" || !errors.Is(err, ErrQueueFull) {
+		t.Error(name, "放回队列失败返回RequeueError", err)
+	}
+	if _, ok := <-errs; ok {
+		t.Error(name, "error chan关闭")
+	}
+	if _, ok := <-ch; ok {
+		t.Error(name, "ctx失效后chan关闭")
+	}
+}
+
+func TestToChanClose(t *testing.T) {
+	name := "TestToChanClose"
+	queue := NewFifoMemoryQueue(1)
+	ch, errs := ToChan(context.Background(), queue)
+	_ = queue.Put(nil, []byte("taken"))
+	for queue.Len() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// 取出的数据未被接收时队列关闭，放回队列失败
+	_ = queue.Close()
+	err := <-errs
+	var requeue *RequeueError
+	if !errors.As(err, &requeue) || string(requeue.Data) != "taken" || !errors.Is(err, ErrQueueClosed) {
+		t.Error(name, "队列关闭后返回RequeueError", err)
+	}
+	if _, ok := <-ch; ok {
+		t.Error(name, "队列关闭后chan关闭")
+	}
+}
+
+func TestToChanGetError(t *testing.T) {
+	name := "TestToChanGetError"
+	storage := NewFaultStorage(NewMemoryStorage())
+	queue, err := NewFifoDiskQueue("queue", WithStorage(storage))
+	if err != nil {
+		panic(err)
+	}
+	defer queue.Close()
+	_ = queue.Put(nil, []byte("data"))
+	storage.Inject(Fault{Op: FaultRead})
+	ch, errs := ToChan(context.Background(), queue)
+	if err := <-errs; !errors.Is(err, ErrInjectedFault) {
+		t.Error(name, "Get异常发送到error chan", err)
+	}
+	if _, ok := <-ch; ok {
+		t.Error(name, "Get异常后chan关闭")
+	}
+}
+
+func TestFromChan(t *testing.T) {
+	name := "TestFromChan"
+	queue := NewLifoMemoryQueue(1024)
+	ch := make(chan []byte, 10)
+	for i := 0; i < 10; i++ {
+		ch <- []byte{byte(i)}
+	}
+	close(ch)
+	if err := FromChan(context.Background(), queue, ch); err != nil {
+		t.Error(name, "chan关闭返回nil", err)
+	}
+	if length := queue.Len(); length != 10 {
+		t.Error(name, "推送10条数据", length)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := FromChan(ctx, queue, make(chan []byte)); !errors.Is(err, context.Canceled) {
+		t.Error(name, "ctx失效返回context.Canceled", err)
+	}
+	_ = queue.Close()
+	ch = make(chan []byte, 1)
+	ch <- []byte{}
+	if err := FromChan(context.Background(), queue, ch); !errors.Is(err, ErrQueueClosed) {
+		t.Error(name, "队列关闭返回ErrQueueClosed", err)
+	}
+}
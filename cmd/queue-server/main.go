@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/czasg/go-queue"
+	"github.com/czasg/go-queue/server"
+)
+
+type queueFlags []string
+
+func (f *queueFlags) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *queueFlags) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// 队列定义格式为 name=kind[:arg]，kind 可选 fifo-memory、lifo-memory、fifo-disk、lifo-disk，
+// 内存队列的 arg 为容量，磁盘队列的 arg 为文件路径
+func newQueue(definition string) (string, queue.Queue, error) {
+	index := strings.Index(definition, "=")
+	if index <= 0 {
+		return "", nil, fmt.Errorf("%s 格式异常", definition)
+	}
+	name, kind := definition[:index], definition[index+1:]
+	arg := ""
+	if index := strings.Index(kind, ":"); index >= 0 {
+		kind, arg = kind[:index], kind[index+1:]
+	}
+	switch kind {
+	case "fifo-memory", "lifo-memory":
+		sizes := []int{}
+		if arg != "" {
+			size, err := strconv.Atoi(arg)
+			if err != nil {
+				return "", nil, err
+			}
+			sizes = append(sizes, size)
+		}
+		if kind == "fifo-memory" {
+			return name, queue.NewFifoMemoryQueue(sizes...), nil
+		}
+		return name, queue.NewLifoMemoryQueue(sizes...), nil
+	case "fifo-disk":
+		q, err := queue.NewFifoDiskQueue(arg)
+		return name, q, err
+	case "lifo-disk":
+		q, err := queue.NewLifoDiskQueue(arg)
+		return name, q, err
+	}
+	return "", nil, fmt.Errorf("unknown queue kind %s", kind)
+}
+
+func main() {
+	var queues queueFlags
+	addr := flag.String("addr", ":8080", "listen address")
+	binaryAddr := flag.String("binary", "", "binary protocol listen address, disabled if empty")
+	respAddr := flag.String("resp", "", "redis protocol listen address, disabled if empty")
+	flag.Var(&queues, "queue", "queue definition name=kind[:arg], repeatable")
+	flag.Parse()
+
+	s := server.NewServer()
+	defer s.Close()
+	// 各协议共用同一组队列，关闭时各自关闭一次，队列的 Close 可重复调用
+	bs := server.NewBinaryServer()
+	defer bs.Close()
+	for _, definition := range queues {
+		name, q, err := newQueue(definition)
+		if err == nil {
+			err = s.Register(name, q)
+		}
+		if err == nil {
+			err = bs.Register(name, q)
+		}
+		if err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	// RESP 的 list 优先使用已定义的队列，未定义的 list 按需创建内存队列
+	rs := server.NewRESPServer(func(name string) (queue.Queue, error) {
+		if q, ok := s.Queue(name); ok {
+			return q, nil
+		}
+		return queue.NewFifoMemoryQueue(), nil
+	})
+	defer rs.Close()
+	for _, listen := range []struct {
+		protocol string
+		addr     string
+		serve    func(net.Listener) error
+	}{
+		{"binary protocol", *binaryAddr, bs.Serve},
+		{"redis protocol", *respAddr, rs.Serve},
+	} {
+		if listen.addr == "" {
+			continue
+		}
+		listener, err := net.Listen("tcp", listen.addr)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		log.Println(listen.protocol, "listening on", listen.addr)
+		serve := listen.serve
+		go func() {
+			if err := serve(listener); err != nil {
+				log.Println(err)
+			}
+		}()
+	}
+
+	srv := &http.Server{Addr: *addr, Handler: s}
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		_ = srv.Shutdown(context.Background())
+	}()
+	log.Println("queue server listening on", *addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Println(err)
+	}
+}
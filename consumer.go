@@ -0,0 +1,185 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrConsumerRunning = errors.New("consumer running")
+
+type Handler func(ctx context.Context, data []byte) error
+
+type WorkerStats struct {
+	Processed int64
+	Failed    int64
+	Panics    int64
+	Requeued  int64
+}
+
+const defaultPollInterval = time.Millisecond * 10
+
+func NewConsumer(queue Queue, concurrency int, handler Handler) *Consumer {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Consumer{
+		PollInterval: defaultPollInterval,
+		queue:        queue,
+		concurrency:  concurrency,
+		handler:      handler,
+	}
+}
+
+type Consumer struct {
+	// 处理失败（含 panic）时将数据重新推回队列
+	Requeue bool
+	// 队列为空时的轮询间隔，磁盘队列的 Get 不支持阻塞。Start 时读取，不大于 0 时使用默认的 10ms
+	PollInterval time.Duration
+	// 处理失败、重新推送失败或获取数据异常时回调，获取数据异常时 data 为 nil
+	OnError func(data []byte, err error)
+
+	queue       Queue
+	concurrency int
+	handler     Handler
+	lock        sync.Mutex
+	cancel      context.CancelFunc
+	done        chan struct{}
+	stats       []*WorkerStats
+}
+
+func (c *Consumer) Start(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.done != nil {
+		select {
+		case <-c.done:
+		default:
+			return ErrConsumerRunning
+		}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	fetchCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	stats := make([]*WorkerStats, c.concurrency)
+	wg := sync.WaitGroup{}
+	for i := range stats {
+		stats[i] = &WorkerStats{}
+		wg.Add(1)
+		go func(stats *WorkerStats) {
+			defer wg.Done()
+			c.work(ctx, fetchCtx, interval, stats)
+		}(stats[i])
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+		close(done)
+	}()
+	c.cancel = cancel
+	c.done = done
+	c.stats = stats
+	return nil
+}
+
+// Stop 停止获取新数据，并等待处理中的数据完成
+func (c *Consumer) Stop() {
+	c.lock.Lock()
+	cancel, done := c.cancel, c.done
+	c.lock.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// Wait 等待所有 worker 退出，队列关闭或 ctx 失效时 worker 自行退出
+func (c *Consumer) Wait() {
+	c.lock.Lock()
+	done := c.done
+	c.lock.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func (c *Consumer) Stats() []WorkerStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	stats := make([]WorkerStats, len(c.stats))
+	for i, s := range c.stats {
+		stats[i] = WorkerStats{
+			Processed: atomic.LoadInt64(&s.Processed),
+			Failed:    atomic.LoadInt64(&s.Failed),
+			Panics:    atomic.LoadInt64(&s.Panics),
+			Requeued:  atomic.LoadInt64(&s.Requeued),
+		}
+	}
+	return stats
+}
+
+func (c *Consumer) work(ctx, fetchCtx context.Context, interval time.Duration, stats *WorkerStats) {
+	for {
+		data, err := GetWait(fetchCtx, c.queue, interval)
+		if err == nil {
+			c.handle(ctx, data, stats)
+			continue
+		}
+		if errors.Is(err, ErrQueueClosed) || fetchCtx.Err() != nil {
+			return
+		}
+		c.onError(nil, err)
+		select {
+		case <-fetchCtx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (c *Consumer) handle(ctx context.Context, data []byte, stats *WorkerStats) {
+	panicked, err := c.call(ctx, data)
+	if err == nil {
+		atomic.AddInt64(&stats.Processed, 1)
+		return
+	}
+	atomic.AddInt64(&stats.Failed, 1)
+	if panicked {
+		atomic.AddInt64(&stats.Panics, 1)
+	}
+	c.onError(data, err)
+	if !c.Requeue {
+		return
+	}
+	if err := c.queue.Put(nil, data); err != nil {
+		c.onError(data, err)
+		return
+	}
+	atomic.AddInt64(&stats.Requeued, 1)
+}
+
+func (c *Consumer) call(ctx context.Context, data []byte) (panicked bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
+			panicked = true
+		}
+	}()
+	return false, c.handler(ctx, data)
+}
+
+func (c *Consumer) onError(data []byte, err error) {
+	if c.OnError != nil {
+		c.OnError(data, err)
+	}
+}
@@ -0,0 +1,157 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConsumer(t *testing.T) {
+	name := "TestConsumer"
+	queue := NewFifoMemoryQueue(1024)
+	for i := 0; i < 100; i++ {
+		_ = queue.Put(nil, []byte{byte(i)})
+	}
+	lock := sync.Mutex{}
+	received := map[byte]bool{}
+	consumer := NewConsumer(queue, 4, func(ctx context.Context, data []byte) error {
+		lock.Lock()
+		defer lock.Unlock()
+		received[data[0]] = true
+		return nil
+	})
+	if err := consumer.Start(context.Background()); err != nil {
+		t.Error(name, "启动返回nil", err)
+	}
+	if err := consumer.Start(context.Background()); !errors.Is(err, ErrConsumerRunning) {
+		t.Error(name, "重复启动返回ErrConsumerRunning", err)
+	}
+	for i := 0; i < 100 && queue.Len() > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	consumer.Stop()
+	if len(received) != 100 {
+		t.Error(name, "消费100条数据", len(received))
+	}
+	stats := consumer.Stats()
+	if len(stats) != 4 {
+		t.Error(name, "worker统计数量为4", len(stats))
+	}
+	var processed int64
+	for _, s := range stats {
+		processed += s.Processed
+	}
+	if processed != 100 {
+		t.Error(name, "处理成功数量为100", processed)
+	}
+	if err := consumer.Start(context.Background()); err != nil {
+		t.Error(name, "停止后重新启动返回nil", err)
+	}
+	_ = queue.Close()
+	consumer.Wait()
+}
+
+func TestConsumerPanicRequeue(t *testing.T) {
+	name := "TestConsumerPanicRequeue"
+	queue := NewLifoMemoryQueue(1024)
+	_ = queue.Put(nil, []byte("data"))
+	var calls int32
+	errs := make(chan error, 2)
+	consumer := NewConsumer(queue, 1, func(ctx context.Context, data []byte) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("boom")
+		}
+		return nil
+	})
+	consumer.Requeue = true
+	consumer.OnError = func(data []byte, err error) {
+		errs <- err
+	}
+	_ = consumer.Start(context.Background())
+	for i := 0; i < 100 && atomic.LoadInt32(&calls) < 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	consumer.Stop()
+	if calls := atomic.LoadInt32(&calls); calls != 2 {
+		t.Error(name, "panic后重新推送并再次处理", calls)
+	}
+	if err := <-errs; err == nil {
+		t.Error(name, "panic回调错误", err)
+	}
+	stats := consumer.Stats()[0]
+	if stats.Panics != 1 || stats.Failed != 1 || stats.Requeued != 1 || stats.Processed != 1 {
+		t.Error(name, "worker统计", stats)
+	}
+}
+
+func TestConsumerDiskQueue(t *testing.T) {
+	name := "TestConsumerDiskQueue"
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(file.Name())
+	defer os.RemoveAll(diskStateFile(file.Name()))
+	file.Close()
+	queue, err := NewFifoDiskQueue(file.Name())
+	if err != nil {
+		panic(err)
+	}
+	received := make(chan []byte, 1)
+	consumer := NewConsumer(queue, 2, func(ctx context.Context, data []byte) error {
+		received <- data
+		return nil
+	})
+	consumer.PollInterval = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	_ = consumer.Start(ctx)
+	time.Sleep(time.Millisecond * 5)
+	_ = queue.Put(nil, []byte("data"))
+	select {
+	case data := <-received:
+		if string(data) != "data" {
+			t.Error(name, "磁盘队列轮询获取数据", data)
+		}
+	case <-time.After(time.Second):
+		t.Error(name, "磁盘队列轮询获取数据超时")
+	}
+	cancel()
+	consumer.Wait()
+	_ = queue.Close()
+}
+
+// 记录 Get 调用次数，用于检查轮询频率
+type countingQueue struct {
+	Queue
+	gets int64
+}
+
+func (q *countingQueue) Get(ctx context.Context) ([]byte, error) {
+	atomic.AddInt64(&q.gets, 1)
+	return q.Queue.Get(nil)
+}
+
+func TestConsumerPollInterval(t *testing.T) {
+	name := "TestConsumerPollInterval"
+	for _, interval := range []time.Duration{0, -time.Second} {
+		queue := &countingQueue{Queue: NewFifoMemoryQueue()}
+		consumer := NewConsumer(queue, 1, func(ctx context.Context, data []byte) error {
+			return nil
+		})
+		consumer.PollInterval = interval
+		ctx, cancel := context.WithCancel(context.Background())
+		_ = consumer.Start(ctx)
+		time.Sleep(time.Millisecond * 50)
+		cancel()
+		consumer.Wait()
+		// 使用默认的 10ms 间隔，不会空转
+		if gets := atomic.LoadInt64(&queue.gets); gets > 20 {
+			t.Error(name, "间隔不大于0时使用默认间隔", interval, gets)
+		}
+	}
+}
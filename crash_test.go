@@ -0,0 +1,269 @@
+package queue
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type crashStep struct {
+	op   string
+	data []byte
+}
+
+// 依次执行 open/put/get/close，每一步都可能因模拟崩溃而失败
+var crashScript = func() []crashStep {
+	steps := []crashStep{{op: "open"}}
+	put := func(from, to int) {
+		for i := from; i < to; i++ {
+			steps = append(steps, crashStep{op: "put", data: bytes.Repeat([]byte{byte(i)}, i%7)})
+		}
+	}
+	get := func(n int) {
+		for i := 0; i < n; i++ {
+			steps = append(steps, crashStep{op: "get"})
+		}
+	}
+	put(1, 6)
+	get(2)
+	put(6, 9)
+	steps = append(steps, crashStep{op: "close"}, crashStep{op: "open"})
+	get(1)
+	put(9, 11)
+	get(7)
+	put(11, 13)
+	steps = append(steps, crashStep{op: "close"}, crashStep{op: "open"})
+	get(1)
+	steps = append(steps, crashStep{op: "close"})
+	return steps
+}()
+
+// 在每一次写入、截断时模拟崩溃，重新打开后校验已确认的 Put 不丢失、已确认的 Get 不重复
+func testCrashConsistency(t *testing.T, name string, lifo bool) {
+	newQueue := NewFifoDiskQueue
+	if lifo {
+		newQueue = NewLifoDiskQueue
+	}
+	for _, short := range []bool{false, true} {
+		for n := 0; ; n++ {
+			memory := NewMemoryStorage()
+			storage := NewFaultStorage(memory)
+			storage.CrashAfter(n, short)
+			var queue Queue
+			var expect [][]byte
+			var inflight *crashStep
+			for i, step := range crashScript {
+				var err error
+				switch step.op {
+				case "open":
+					queue, err = newQueue("queue", WithStorage(storage))
+				case "put":
+					if err = queue.Put(nil, step.data); err == nil {
+						expect = append(expect, step.data)
+					}
+				case "get":
+					var data []byte
+					if data, err = queue.Get(nil); err == nil {
+						index := 0
+						if lifo {
+							index = len(expect) - 1
+						}
+						if !bytes.Equal(data, expect[index]) {
+							t.Fatal(name, "崩溃前按序获取数据", n, data, expect[index])
+						}
+						expect = append(expect[:index], expect[index+1:]...)
+					}
+				case "close":
+					err = queue.Close()
+				}
+				if err != nil {
+					if !storage.Crashed() {
+						t.Fatal(name, "未崩溃时操作失败", n, i, step.op, err)
+					}
+					inflight = &crashScript[i]
+					break
+				}
+			}
+			if !storage.Crashed() {
+				break
+			}
+
+			queue, err := newQueue("queue", WithStorage(memory))
+			if err != nil {
+				t.Fatal(name, "崩溃后重新打开", n, short, inflight.op, err)
+			}
+			var got [][]byte
+			for queue.Len() > 0 {
+				data, err := queue.Get(nil)
+				if err != nil {
+					t.Fatal(name, "崩溃后读取数据", n, err)
+				}
+				got = append(got, data)
+			}
+			_ = queue.Close()
+			if lifo {
+				for i, j := 0, len(got)-1; i < j; i, j = i+1, j-1 {
+					got[i], got[j] = got[j], got[i]
+				}
+			}
+			if len(got) == 0 {
+				got = nil
+			}
+			if len(expect) == 0 {
+				expect = nil
+			}
+			// 崩溃时未完成的 Put 可能已经写入
+			maybe := append(append([][]byte{}, expect...), inflight.data)
+			if !reflect.DeepEqual(got, expect) && !(inflight.op == "put" && reflect.DeepEqual(got, maybe)) {
+				t.Fatal(name, fmt.Sprintf("第%d次写入崩溃(%s, short=%v)后数据不一致", n, inflight.op, short), got, expect)
+			}
+		}
+	}
+}
+
+func TestFifoDiskQueueCrash(t *testing.T) {
+	testCrashConsistency(t, "TestFifoDiskQueueCrash", false)
+}
+
+func TestLifoDiskQueueCrash(t *testing.T) {
+	testCrashConsistency(t, "TestLifoDiskQueueCrash", true)
+}
+
+func TestDiskQueueLegacyFooter(t *testing.T) {
+	name := "TestDiskQueueLegacyFooter"
+	storage := NewMemoryStorage()
+	// 旧版本关闭时在文件末尾写入 "index,offset" 及其长度，第一条数据已被读取
+	storage.SetBytes("fifo", []byte("\x00\x00\x00\x01a\x00\x00\x00\x01b\x00\x00\x00\x01c2,5\x00\x00\x00\x03"))
+	storage.SetBytes("lifo", []byte("a\x00\x00\x00\x01b\x00\x00\x00\x012\x00\x00\x00\x01"))
+	for file, expect := range map[string][]string{"fifo": {"b", "c"}, "lifo": {"b", "a"}} {
+		newQueue := NewFifoDiskQueue
+		if file == "lifo" {
+			newQueue = NewLifoDiskQueue
+		}
+		queue, err := newQueue(file, WithStorage(storage))
+		if err != nil {
+			t.Fatal(name, "读取旧格式", file, err)
+		}
+		for _, data := range expect {
+			if got, err := queue.Get(nil); string(got) != data || err != nil {
+				t.Error(name, "旧格式数据", file, string(got), err)
+			}
+		}
+		_ = queue.Close()
+	}
+}
+
+func TestDiskQueueCorrupted(t *testing.T) {
+	name := "TestDiskQueueCorrupted"
+	for _, data := range []string{
+		"\x00\x00",
+		"\xff\xff\xff\xff",
+		"\x7f\xff\xff\xff",
+		"\x00\x00\x00\x01a-1,0\x00\x00\x00\x04",
+		"\x00\x00\x00\x01a1,9\x00\x00\x00\x03",
+		"\x00\x00\x00\x09a1,0\x00\x00\x00\x03",
+	} {
+		storage := NewMemoryStorage()
+		storage.SetBytes("queue", []byte(data))
+		if _, err := NewFifoDiskQueue("queue", WithStorage(storage)); !errors.Is(err, ErrQueueCorrupted) {
+			t.Error(name, "FIFO损坏文件返回ErrQueueCorrupted", []byte(data), err)
+		}
+	}
+	for _, data := range []string{
+		"\x00\x00",
+		"\xff\xff\xff\xff",
+		"a\x00\x00\x00\x011\x00\x00\x00\x01x",
+		"a\x00\x00\x00\x09-1\x00\x00\x00\x02",
+		"a\x00\x00\x00\x091\x00\x00\x00\x01",
+		"a\x00\x00\x00\x012\x00\x00\x00\x01",
+	} {
+		storage := NewMemoryStorage()
+		storage.SetBytes("queue", []byte(data))
+		if _, err := NewLifoDiskQueue("queue", WithStorage(storage)); !errors.Is(err, ErrQueueCorrupted) {
+			t.Error(name, "LIFO损坏文件返回ErrQueueCorrupted", []byte(data), err)
+		}
+	}
+	// 校验和正确但条数过大的状态，条数乘以记录头长度会溢出
+	for label, open := range map[string]func(string, ...DiskOption) (Queue, error){
+		"FIFO": NewFifoDiskQueue,
+		"LIFO": NewLifoDiskQueue,
+	} {
+		storage := NewMemoryStorage()
+		storage.SetBytes("queue", []byte("\x00\x00\x00\x00"))
+		state, _, _, err := openDiskState(storage, "queue")
+		if err != nil {
+			panic(err)
+		}
+		_ = state.save(1<<62, 0, 4, 4)
+		_ = state.Close()
+		if _, err := open("queue", WithStorage(storage), WithRetention(Retention{MaxAge: time.Hour})); !errors.Is(err, ErrQueueCorrupted) {
+			t.Error(name, label, "条数过大的状态返回ErrQueueCorrupted", err)
+		}
+	}
+}
+
+func TestDiskQueueRetentionAge(t *testing.T) {
+	name := "TestDiskQueueRetentionAge"
+	for label, open := range map[string]func(string, ...DiskOption) (Queue, error){
+		"FIFO": NewFifoDiskQueue,
+		"LIFO": NewLifoDiskQueue,
+	} {
+		storage := NewMemoryStorage()
+		queue, err := open("queue", WithStorage(storage), WithRetention(Retention{MaxAge: time.Hour}))
+		if err != nil {
+			panic(err)
+		}
+		_ = queue.Put(nil, []byte("a"))
+		time.Sleep(time.Millisecond * 200)
+		_ = queue.Put(nil, []byte("b"))
+		_ = queue.Close()
+		// 不设置 MaxAge 时按原有格式读取
+		queue, err = open("queue", WithStorage(storage))
+		if err != nil || queue.Len() != 2 {
+			t.Error(name, label, "不设置MaxAge重新打开", err)
+			continue
+		}
+		_ = queue.Close()
+		queue, err = open("queue", WithStorage(storage), WithRetention(Retention{MaxAge: time.Millisecond * 100}))
+		if err != nil {
+			panic(err)
+		}
+		if data, err := queue.Get(nil); err != nil || string(data) != "b" || queue.Len() != 0 {
+			t.Error(name, label, "重新打开后按保存的写入时间丢弃数据", string(data), err, queue.Len())
+		}
+		_ = queue.Close()
+	}
+}
+
+func TestDiskQueueRetentionError(t *testing.T) {
+	name := "TestDiskQueueRetentionError"
+	// 跳过数据及状态写入，在丢弃数据时写入失败，LIFO 还会在移动数据时写入失败
+	for label, test := range map[string]struct {
+		open   func(string, ...DiskOption) (Queue, error)
+		faults int
+	}{
+		"FIFO": {NewFifoDiskQueue, 1},
+		"LIFO": {NewLifoDiskQueue, 2},
+	} {
+		open := test.open
+		for after := 2; after < 2+test.faults; after++ {
+			storage := NewFaultStorage(NewMemoryStorage())
+			queue, err := open("queue", WithStorage(storage), WithRetention(Retention{MaxItems: 1}))
+			if err != nil {
+				panic(err)
+			}
+			_ = queue.Put(nil, []byte("a"))
+			storage.Inject(Fault{Op: FaultWrite, After: after, Times: 1})
+			if err := queue.Put(nil, []byte("b")); err != nil {
+				t.Error(name, label, after, "数据写入后丢弃失败不影响Put", err)
+			}
+			if data, err := queue.Get(nil); err != nil || string(data) != "b" || queue.Len() != 0 {
+				t.Error(name, label, after, "丢弃失败后重试", string(data), err, queue.Len())
+			}
+			_ = queue.Close()
+		}
+	}
+}
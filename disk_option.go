@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"fmt"
+	"time"
+)
+
+// 磁盘队列保留策略，为 0 表示不限制，超出限制时优先丢弃最旧的数据。
+type Retention struct {
+	// FifoDiskQueue、LifoDiskQueue 新建或为空时设置了 MaxAge，每条记录会保存写入时间，重新打开后按写入时间计算；
+	// 没有保存写入时间的已有数据按打开时间计算
+	MaxAge   time.Duration
+	MaxItems int
+	MaxBytes int64
+	// 丢弃数据后回调，evicted 为本次丢弃的数量。回调时持有队列锁，不能再调用该队列的方法
+	OnEvict func(evicted int)
+}
+
+func (r Retention) enabled() bool {
+	return r.MaxAge > 0 || r.MaxItems > 0 || r.MaxBytes > 0
+}
+
+func (r Retention) exceeded(items int, bytes int64, oldest func() time.Time) bool {
+	if items <= 0 {
+		return false
+	}
+	return (r.MaxItems > 0 && items > r.MaxItems) ||
+		(r.MaxBytes > 0 && bytes > r.MaxBytes) ||
+		(r.MaxAge > 0 && time.Since(oldest()) > r.MaxAge)
+}
+
+func (r Retention) evicted(evicted int) {
+	if evicted > 0 && r.OnEvict != nil {
+		r.OnEvict(evicted)
+	}
+}
+
+type DiskOption func(*diskOptions)
+
+type diskOptions struct {
+	retention Retention
+	observers []Observer
+	storage   Storage
+	// 单条数据的最大字节数，0 表示只受记录格式限制
+	maxMessageSize int64
+	largeRecords   bool
+	sync           bool
+	groupCommit    bool
+}
+
+func WithRetention(retention Retention) DiskOption {
+	return func(o *diskOptions) {
+		o.retention = retention
+	}
+}
+
+// WithObserver 打开时注册观察者，从文件恢复数据时回调 EventRecovered。LogDiskQueue 不支持
+func WithObserver(observer Observer) DiskOption {
+	return func(o *diskOptions) {
+		o.observers = append(o.observers, observer)
+	}
+}
+
+// WithStorage 指定存储后端，LogDiskQueue 不支持
+func WithStorage(storage Storage) DiskOption {
+	return func(o *diskOptions) {
+		o.storage = storage
+	}
+}
+
+// WithMaxMessageSize 单条数据的最大字节数，超出时 Put 返回 ErrMessageTooLarge
+func WithMaxMessageSize(size int64) DiskOption {
+	return func(o *diskOptions) {
+		o.maxMessageSize = size
+	}
+}
+
+// WithLargeRecords 使用 64 位长度的记录格式，单条数据可以超过 2GiB，默认使用 32 位长度。
+// 仅 FifoDiskQueue、LifoDiskQueue 支持，只在新建或为空的队列上生效，已有数据的队列沿用原有格式。
+// LogDiskQueue 使用不支持的选项时返回 ErrUnsupportedOption。
+func WithLargeRecords() DiskOption {
+	return func(o *diskOptions) {
+		o.largeRecords = true
+	}
+}
+
+// WithSync 每次写入数据及状态后调用 Sync 持久化到磁盘，机器掉电也不会丢失已确认的数据，默认只保证进程崩溃时不丢失。
+// 仅 FifoDiskQueue、LifoDiskQueue 支持
+func WithSync() DiskOption {
+	return func(o *diskOptions) {
+		o.sync = true
+	}
+}
+
+// WithGroupCommit 将并发的 Put 合并为一次写入、一次状态保存，配合 WithSync 时也只调用一次 Sync，
+// 每个 Put 在其所在批次写入后返回，并发写入较多时可以显著提高吞吐量。仅 FifoDiskQueue、LifoDiskQueue 支持
+func WithGroupCommit() DiskOption {
+	return func(o *diskOptions) {
+		o.groupCommit = true
+	}
+}
+
+// 开启 WithSync 时持久化文件
+func (o diskOptions) syncFile(file File) error {
+	if !o.sync {
+		return nil
+	}
+	return file.Sync()
+}
+
+// 新建队列时记录长度字段的字节数
+func (o diskOptions) recordHeader() int {
+	if o.largeRecords {
+		return 8
+	}
+	return 4
+}
+
+// 新建队列时记录写入时间字段的字节数，只在设置了 MaxAge 时保存写入时间
+func (o diskOptions) recordStamp() int {
+	if o.retention.MaxAge > 0 {
+		return recordStampSize
+	}
+	return 0
+}
+
+func (o diskOptions) checkSize(size int64, header int) error {
+	limit := maxRecordSize(header)
+	if o.maxMessageSize > 0 && o.maxMessageSize < limit {
+		limit = o.maxMessageSize
+	}
+	if size > limit {
+		return fmt.Errorf("%w: %d > %d", ErrMessageTooLarge, size, limit)
+	}
+	return nil
+}
+
+func newDiskOptions(options []DiskOption) diskOptions {
+	o := diskOptions{storage: OSStorage{}}
+	for _, option := range options {
+		option(&o)
+	}
+	return o
+}
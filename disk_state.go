@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"time"
+)
+
+// 旧格式文件末尾状态的最大长度，"index,offset" 不会超过该长度
+const maxFooterSize = 64
+
+// 状态文件由两个槽位组成，交替写入，每个槽位为 [uint64 序号][4 个 int64 状态值][uint32 校验和]。
+// 写入中断时损坏的槽位校验失败，重新打开时使用另一个槽位中的上一次状态。
+const diskStateSlotSize = 8 + 4*8 + 4
+
+type diskState struct {
+	file File
+	seq  uint64
+	slot [diskStateSlotSize]byte
+	// 每次保存后调用 Sync
+	sync bool
+}
+
+func diskStateFile(file string) string {
+	return file + ".state"
+}
+
+// 记录中写入时间字段的字节数，为 int64 UnixNano
+const recordStampSize = 8
+
+// 状态中保存的记录头字节数为长度字段与写入时间字段之和，拆分为两者，record 不合法时返回 ok 为 false
+func recordFormat(record int64) (header, stamp int, ok bool) {
+	switch record {
+	case 4, 8:
+		return int(record), 0, true
+	case 4 + recordStampSize, 8 + recordStampSize:
+		return int(record) - recordStampSize, recordStampSize, true
+	}
+	return 0, 0, false
+}
+
+func putRecordTime(buf []byte, t time.Time) {
+	if len(buf) == recordStampSize {
+		binary.BigEndian.PutUint64(buf, uint64(t.UnixNano()))
+	}
+}
+
+func recordTime(buf []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(buf)))
+}
+
+// 记录长度字段为 header 字节时单条数据的最大长度
+func maxRecordSize(header int) int64 {
+	if header == 8 {
+		return math.MaxInt64
+	}
+	return math.MaxInt32
+}
+
+func putRecordLength(buf []byte, length int) {
+	if len(buf) == 8 {
+		binary.BigEndian.PutUint64(buf, uint64(length))
+		return
+	}
+	binary.BigEndian.PutUint32(buf, uint32(length))
+}
+
+// 按有符号整数读取，损坏的长度字段返回负数
+func recordLength(buf []byte) int64 {
+	if len(buf) == 8 {
+		return int64(binary.BigEndian.Uint64(buf))
+	}
+	return int64(int32(binary.BigEndian.Uint32(buf)))
+}
+
+func corruptedError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: "+format, append([]interface{}{ErrQueueCorrupted}, args...)...)
+}
+
+// openDiskState 打开状态文件，返回最新的有效状态，ok 为 false 表示没有有效状态
+func openDiskState(storage Storage, file string) (state *diskState, values [4]int64, ok bool, err error) {
+	state = &diskState{}
+	state.file, err = storage.Open(diskStateFile(file))
+	if err != nil {
+		return nil, values, false, err
+	}
+	buf := make([]byte, 2*diskStateSlotSize)
+	n, _ := state.file.ReadAt(buf, 0)
+	for i := 0; (i+1)*diskStateSlotSize <= n; i++ {
+		slot := buf[i*diskStateSlotSize : (i+1)*diskStateSlotSize]
+		if crc32.ChecksumIEEE(slot[:diskStateSlotSize-4]) != binary.BigEndian.Uint32(slot[diskStateSlotSize-4:]) {
+			continue
+		}
+		seq := binary.BigEndian.Uint64(slot)
+		if ok && seq <= state.seq {
+			continue
+		}
+		state.seq, ok = seq, true
+		for j := range values {
+			values[j] = int64(binary.BigEndian.Uint64(slot[8+8*j:]))
+		}
+	}
+	return state, values, ok, nil
+}
+
+// save 写入下一个槽位，失败时不推进序号，下次仍写入同一槽位，保证另一个槽位始终有效
+func (s *diskState) save(values ...int64) error {
+	seq := s.seq + 1
+	slot := s.slot[:]
+	binary.BigEndian.PutUint64(slot, seq)
+	for i, value := range values {
+		binary.BigEndian.PutUint64(slot[8+8*i:], uint64(value))
+	}
+	binary.BigEndian.PutUint32(slot[diskStateSlotSize-4:], crc32.ChecksumIEEE(slot[:diskStateSlotSize-4]))
+	if _, err := s.file.WriteAt(slot, int64(seq%2)*diskStateSlotSize); err != nil {
+		return err
+	}
+	if s.sync {
+		if err := s.file.Sync(); err != nil {
+			return err
+		}
+	}
+	s.seq = seq
+	return nil
+}
+
+func (s *diskState) Close() error {
+	return s.file.Close()
+}
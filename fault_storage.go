@@ -0,0 +1,203 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// ErrInjectedFault FaultStorage 默认注入的错误
+var ErrInjectedFault = errors.New("injected fault")
+
+type FaultOp int
+
+const (
+	FaultOpen FaultOp = iota + 1
+	FaultRead
+	// FaultWrite 包括 Write 与 WriteAt
+	FaultWrite
+	FaultTruncate
+	FaultSync
+)
+
+// Fault 注入规则，对应类型的操作再成功 After 次后开始失败，共失败 Times 次，Times 为 0 表示一直失败。
+// Short 为 true 时写入操作先写入一半数据再返回错误，模拟短写。
+type Fault struct {
+	Op    FaultOp
+	After int
+	Times int
+	Err   error
+	Short bool
+}
+
+// NewFaultStorage 包装 storage 并按规则注入错误，storage 为 nil 时使用 OSStorage
+func NewFaultStorage(storage Storage) *FaultStorage {
+	if storage == nil {
+		storage = OSStorage{}
+	}
+	return &FaultStorage{storage: storage, ops: map[FaultOp]int{}}
+}
+
+var _ Storage = (*FaultStorage)(nil)
+
+type FaultStorage struct {
+	storage Storage
+	lock    sync.Mutex
+	faults  []*faultRule
+	ops     map[FaultOp]int
+	// 模拟崩溃，剩余 crashAfter 次写入或截断后崩溃
+	crash      *Fault
+	crashAfter int
+	crashed    bool
+}
+
+// Inject 添加注入规则
+func (s *FaultStorage) Inject(fault Fault) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = append(s.faults, &faultRule{Fault: fault})
+}
+
+// CrashAfter 再成功完成 n 次写入或截断后模拟进程崩溃，崩溃点及之后的所有操作都失败且不生效，
+// short 为 true 时崩溃点的写入只写入一半数据。底层 storage 中保留崩溃时的文件内容，可以直接重新打开
+func (s *FaultStorage) CrashAfter(n int, short bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.crash = &Fault{Short: short}
+	s.crashAfter = n
+	s.crashed = false
+}
+
+// Crashed 是否已经模拟崩溃
+func (s *FaultStorage) Crashed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.crashed
+}
+
+// Reset 清除所有规则、崩溃状态及操作计数
+func (s *FaultStorage) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = nil
+	s.ops = map[FaultOp]int{}
+	s.crash = nil
+	s.crashed = false
+}
+
+// Ops 返回 op 类型操作的调用次数，包括失败的调用
+func (s *FaultStorage) Ops(op FaultOp) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.ops[op]
+}
+
+// 返回本次操作是否失败，以及失败时的规则
+func (s *FaultStorage) check(op FaultOp) *Fault {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.ops[op]++
+	if s.crashed {
+		return &Fault{Op: op}
+	}
+	if s.crash != nil && (op == FaultWrite || op == FaultTruncate) {
+		if s.crashAfter == 0 {
+			s.crashed = true
+			return s.crash
+		}
+		s.crashAfter--
+	}
+	for _, rule := range s.faults {
+		if rule.Op != op {
+			continue
+		}
+		if rule.After > 0 {
+			rule.After--
+			continue
+		}
+		if rule.Times > 0 && rule.failed >= rule.Times {
+			continue
+		}
+		rule.failed++
+		return &rule.Fault
+	}
+	return nil
+}
+
+type faultRule struct {
+	Fault
+	failed int
+}
+
+func (f *Fault) err() error {
+	if f.Err != nil {
+		return f.Err
+	}
+	return ErrInjectedFault
+}
+
+func (s *FaultStorage) Open(name string) (File, error) {
+	if fault := s.check(FaultOpen); fault != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: fault.err()}
+	}
+	file, err := s.storage.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: file, storage: s}, nil
+}
+
+type faultFile struct {
+	File
+	storage *FaultStorage
+}
+
+func (f *faultFile) Read(p []byte) (int, error) {
+	if fault := f.storage.check(FaultRead); fault != nil {
+		return 0, fault.err()
+	}
+	return f.File.Read(p)
+}
+
+func (f *faultFile) ReadAt(p []byte, off int64) (int, error) {
+	if fault := f.storage.check(FaultRead); fault != nil {
+		return 0, fault.err()
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	if fault := f.storage.check(FaultWrite); fault != nil {
+		if fault.Short {
+			n, _ := f.File.Write(p[:len(p)/2])
+			return n, fault.err()
+		}
+		return 0, fault.err()
+	}
+	return f.File.Write(p)
+}
+
+func (f *faultFile) WriteAt(p []byte, off int64) (int, error) {
+	if fault := f.storage.check(FaultWrite); fault != nil {
+		if fault.Short {
+			n, _ := f.File.WriteAt(p[:len(p)/2], off)
+			return n, fault.err()
+		}
+		return 0, fault.err()
+	}
+	return f.File.WriteAt(p, off)
+}
+
+func (f *faultFile) Truncate(size int64) error {
+	if fault := f.storage.check(FaultTruncate); fault != nil {
+		return fault.err()
+	}
+	return f.File.Truncate(size)
+}
+
+func (f *faultFile) Sync() error {
+	if fault := f.storage.check(FaultSync); fault != nil {
+		return fault.err()
+	}
+	return f.File.Sync()
+}
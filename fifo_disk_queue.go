@@ -1,149 +1,296 @@
 package queue
 
 import (
-    "bytes"
     "context"
-    "encoding/binary"
-    "fmt"
     "io"
-    "os"
     "strconv"
     "strings"
     "sync"
+    "time"
 )
 
-func NewFifoDiskQueue(file string) (Queue, error) {
-    var err error
+func NewFifoDiskQueue(file string, options ...DiskOption) (Queue, error) {
     ctx, cancel := context.WithCancel(context.Background())
     queue := FifoDiskQueue{
-        ctx:    ctx,
-        cancel: cancel,
+        ctx:     ctx,
+        cancel:  cancel,
+        options: newDiskOptions(options),
     }
-    queue.writeFile, err = os.OpenFile(file, os.O_RDWR|os.O_CREATE, os.ModePerm)
-    if err != nil {
-        return nil, err
+    for _, observer := range queue.options.observers {
+        queue.AddObserver(observer)
     }
-    queue.readFile, err = os.OpenFile(file, os.O_RDONLY, os.ModePerm)
+    err := queue.open(file)
     if err != nil {
         return nil, err
     }
-    stat, err := queue.readFile.Stat()
-    if err != nil {
-        return nil, err
+    if queue.options.groupCommit {
+        queue.commits = newGroupCommit(queue.flush)
     }
-    if stat.Size() == 0 {
-        return &queue, nil
+    queue.notify(Event{Type: EventRecovered, Len: queue.index, Size: queue.end - queue.offset - queue.record()*queue.index})
+    return &queue, nil
+}
+
+var _ StreamQueue = (*FifoDiskQueue)(nil)
+var _ BufferQueue = (*FifoDiskQueue)(nil)
+var _ StatsQueue = (*FifoDiskQueue)(nil)
+
+// FifoDiskQueue 数据文件中的每条数据为 [int32 长度][数据]，使用 WithLargeRecords 时为 [int64 长度][数据]，
+// 设置了 Retention.MaxAge 时长度之后为 [int64 写入时间]，
+// 读取位置、数据结束位置等状态在每次 Put/Get 后写入状态文件，进程崩溃后重新打开不会丢失或重复已确认的数据
+type FifoDiskQueue struct {
+    index   int
+    offset  int
+    end     int
+    // 记录长度字段的字节数，4 或 8
+    header  int
+    // 记录写入时间字段的字节数，0 或 8
+    stamp   int
+    // 打开以来成功的 Put/Get 次数
+    puts    int64
+    gets    int64
+    // 读取记录头时复用，持有锁时使用
+    scratch [16]byte
+    // 没有保存写入时间的数据按打开或写入时间记录在内存中
+    times   []time.Time
+    options diskOptions
+    file    File
+    state   *diskState
+    commits *groupCommit
+    lock    sync.Mutex
+    ctx     context.Context
+    cancel  context.CancelFunc
+    observers
+}
+
+func (q *FifoDiskQueue) Get(ctx context.Context) ([]byte, error) {
+    return q.GetInto(ctx, nil)
+}
+
+func (q *FifoDiskQueue) GetInto(ctx context.Context, dst []byte) ([]byte, error) {
+    select {
+    case <-q.ctx.Done():
+        return nil, ErrQueueClosed
+    default:
     }
-    _, err = queue.writeFile.Seek(-4, io.SeekEnd)
+    q.lock.Lock()
+    defer q.lock.Unlock()
+    err := q.retain()
     if err != nil {
         return nil, err
     }
-    buf := make([]byte, 4)
-    _, err = queue.writeFile.Read(buf)
-    if err != nil {
-        return nil, err
+    if q.index <= 0 {
+        return nil, ErrQueueEmpty
     }
-    var length int32
-    err = binary.Read(bytes.NewBuffer(buf), binary.BigEndian, &length)
+    length, err := q.length(q.offset)
     if err != nil {
         return nil, err
     }
-    offset, err := queue.writeFile.Seek(int64(-4-length), io.SeekCurrent)
+    buf := grow(dst, length)
+    _, err = q.file.ReadAt(buf, int64(q.offset+q.record()))
     if err != nil {
         return nil, err
     }
-    buf = make([]byte, length)
-    _, err = queue.writeFile.Read(buf)
+    err = q.consume(length)
     if err != nil {
         return nil, err
     }
-    bufs := strings.Split(string(buf), ",")
-    if len(bufs) != 2 {
-        return nil, fmt.Errorf("%s 格式异常", string(buf))
+    return buf, nil
+}
+
+func (q *FifoDiskQueue) GetWriter(ctx context.Context, w io.Writer) (int64, error) {
+    select {
+    case <-q.ctx.Done():
+        return 0, ErrQueueClosed
+    default:
     }
-    indexString := bufs[0]
-    offsetString := bufs[1]
-    queue.index, err = strconv.Atoi(indexString)
+    q.lock.Lock()
+    defer q.lock.Unlock()
+    reader, err := q.reader()
     if err != nil {
-        return nil, err
+        return 0, err
     }
-    queue.offset, err = strconv.Atoi(offsetString)
+    n, err := copyStream(ctx, w, reader, reader.Size())
     if err != nil {
-        return nil, err
+        return n, err
+    }
+    return n, q.consume(int(n))
+}
+
+func (q *FifoDiskQueue) GetReader(ctx context.Context) (*RecordReader, error) {
+    select {
+    case <-q.ctx.Done():
+        return nil, ErrQueueClosed
+    default:
     }
-    err = queue.writeFile.Truncate(offset)
+    q.lock.Lock()
+    reader, err := q.reader()
     if err != nil {
+        q.lock.Unlock()
         return nil, err
     }
-    _, err = queue.writeFile.Seek(0, io.SeekEnd)
+    return &RecordReader{reader: reader, ctx: ctx, done: func(read bool) error {
+        defer q.lock.Unlock()
+        if !read {
+            return nil
+        }
+        return q.consume(int(reader.Size()))
+    }}, nil
+}
+
+// 返回读取位置数据的读取器，队列为空时返回 ErrQueueEmpty
+func (q *FifoDiskQueue) reader() (*io.SectionReader, error) {
+    err := q.retain()
     if err != nil {
         return nil, err
     }
-    _, err = queue.readFile.Seek(int64(queue.offset), io.SeekStart)
+    if q.index <= 0 {
+        return nil, ErrQueueEmpty
+    }
+    length, err := q.length(q.offset)
     if err != nil {
         return nil, err
     }
-    return &queue, nil
+    return io.NewSectionReader(q.file, int64(q.offset+q.record()), int64(length)), nil
 }
 
-var _ Queue = (*FifoDiskQueue)(nil)
-
-type FifoDiskQueue struct {
-    index     int
-    offset    int
-    readFile  *os.File
-    writeFile *os.File
-    lock      sync.Mutex
-    ctx       context.Context
-    cancel    context.CancelFunc
+// 移除读取位置长度为 length 的数据
+func (q *FifoDiskQueue) consume(length int) error {
+    var err error
+    if q.index == 1 {
+        err = q.save(0, 0, 0)
+    } else {
+        err = q.save(q.index-1, q.offset+q.record()+length, q.end)
+    }
+    if err != nil {
+        return err
+    }
+    q.pop(length)
+    q.gets++
+    if q.index == 0 {
+        q.offset, q.end = 0, 0
+    }
+    q.notify(Event{Type: EventGet, Len: q.index, Size: length})
+    if q.index == 0 {
+        q.notify(Event{Type: EventEmpty})
+    }
+    return nil
 }
 
-func (q *FifoDiskQueue) Get(ctx context.Context) ([]byte, error) {
+func (q *FifoDiskQueue) Put(ctx context.Context, data []byte) error {
     select {
     case <-q.ctx.Done():
-        return nil, ErrQueueClosed
+        return ErrQueueClosed
     default:
     }
+    // header 打开后不再改变
+    err := q.options.checkSize(int64(len(data)), q.header)
+    if err != nil {
+        return err
+    }
+    if q.commits != nil {
+        return q.commits.put(data)
+    }
     q.lock.Lock()
     defer q.lock.Unlock()
-    if q.index <= 0 {
-        return nil, ErrQueueEmpty
+    buf := getBuffer(q.record() + len(data))
+    defer putBuffer(buf)
+    putRecordLength((*buf)[:q.header], len(data))
+    putRecordTime((*buf)[q.header:q.record()], time.Now())
+    copy((*buf)[q.record():], data)
+    _, err = q.file.WriteAt(*buf, int64(q.end))
+    if err != nil {
+        return err
     }
-    buf := make([]byte, 4)
-    _, err := q.readFile.Read(buf)
+    return q.commit(len(data))
+}
+
+func (q *FifoDiskQueue) PutReader(ctx context.Context, r io.Reader, size int64) error {
+    select {
+    case <-q.ctx.Done():
+        return ErrQueueClosed
+    default:
+    }
+    if size < 0 {
+        return errNegativeSize
+    }
+    q.lock.Lock()
+    defer q.lock.Unlock()
+    err := q.options.checkSize(size, q.header)
     if err != nil {
-        return nil, err
+        return err
     }
-    var length int32
-    err = binary.Read(bytes.NewBuffer(buf), binary.BigEndian, &length)
+    buf := q.scratch[:q.record()]
+    putRecordLength(buf[:q.header], int(size))
+    putRecordTime(buf[q.header:], time.Now())
+    _, err = q.file.WriteAt(buf, int64(q.end))
     if err != nil {
-        return nil, err
+        return err
     }
-    buf = make([]byte, length)
-    _, err = q.readFile.Read(buf)
+    _, err = copyStream(ctx, &offsetWriter{file: q.file, offset: int64(q.end + q.record())}, r, size)
     if err != nil {
-        return nil, err
+        return err
     }
-    q.index--
-    q.offset += int(length) + 4
-    return buf, nil
+    return q.commit(int(size))
 }
 
-func (q *FifoDiskQueue) Put(ctx context.Context, data []byte) error {
+// 合并写入一批数据
+func (q *FifoDiskQueue) flush(batch []*commitRequest) error {
+    q.lock.Lock()
+    defer q.lock.Unlock()
     select {
     case <-q.ctx.Done():
         return ErrQueueClosed
     default:
     }
-    q.lock.Lock()
-    defer q.lock.Unlock()
-    buf := new(bytes.Buffer)
-    _ = binary.Write(buf, binary.BigEndian, int32(len(data)))
-    _, err := q.writeFile.Write(bytes.Join([][]byte{buf.Bytes(), data}, []byte("")))
+    size := 0
+    lengths := make([]int, len(batch))
+    for i, request := range batch {
+        lengths[i] = len(request.data)
+        size += q.record() + lengths[i]
+    }
+    buf := getBuffer(size)
+    defer putBuffer(buf)
+    now := time.Now()
+    position := 0
+    for _, request := range batch {
+        putRecordLength((*buf)[position:position+q.header], len(request.data))
+        putRecordTime((*buf)[position+q.header:position+q.record()], now)
+        copy((*buf)[position+q.record():], request.data)
+        position += q.record() + len(request.data)
+    }
+    _, err := q.file.WriteAt(*buf, int64(q.end))
+    if err != nil {
+        return err
+    }
+    return q.commit(lengths...)
+}
+
+// 数据已写入结束位置之后，保存状态使其可见
+func (q *FifoDiskQueue) commit(lengths ...int) error {
+    err := q.options.syncFile(q.file)
+    if err != nil {
+        return err
+    }
+    size := 0
+    for _, length := range lengths {
+        size += q.record() + length
+    }
+    err = q.save(q.index+len(lengths), q.offset, q.end+size)
     if err != nil {
         return err
     }
-    q.index++
+    q.end += size
+    now := time.Now()
+    for _, length := range lengths {
+        q.index++
+        q.puts++
+        if q.options.retention.MaxAge > 0 && q.stamp == 0 {
+            q.times = append(q.times, now)
+        }
+        q.notify(Event{Type: EventPut, Len: q.index, Size: length})
+    }
+    // 数据已经写入，丢弃旧数据失败不影响本次 Put，下次操作时重试
+    _ = q.retain()
     return nil
 }
 
@@ -156,28 +303,231 @@ func (q *FifoDiskQueue) Close() error {
     q.lock.Lock()
     defer q.lock.Unlock()
     q.cancel()
+    q.notify(Event{Type: EventClosed, Len: q.index})
     defer func() {
-        q.readFile.Close()
-        q.writeFile.Close()
+        q.file.Close()
+        q.state.Close()
     }()
     if q.index < 1 {
-        return q.writeFile.Truncate(0)
+        err := q.save(0, 0, 0)
+        if err != nil {
+            return err
+        }
+        return q.file.Truncate(0)
     }
-    offset, err := q.writeFile.Seek(0, io.SeekCurrent)
+    return q.file.Truncate(int64(q.end))
+}
+
+func (q *FifoDiskQueue) Len() int {
+    q.lock.Lock()
+    defer q.lock.Unlock()
+    return q.index
+}
+
+func (q *FifoDiskQueue) Stats() Stats {
+    q.lock.Lock()
+    defer q.lock.Unlock()
+    return Stats{
+        Len:         q.index,
+        Bytes:       int64(q.end - q.offset),
+        ReadOffset:  int64(q.offset),
+        WriteOffset: int64(q.end),
+        Puts:        q.puts,
+        Gets:        q.gets,
+        Closed:      q.ctx.Err() != nil,
+    }
+}
+
+func (q *FifoDiskQueue) open(file string) error {
+    var err error
+    var ok bool
+    var values [4]int64
+    q.file, err = q.options.storage.Open(file)
+    if err != nil {
+        return err
+    }
+    q.state, values, ok, err = openDiskState(q.options.storage, file)
     if err != nil {
+        q.file.Close()
         return err
     }
-    err = q.writeFile.Truncate(offset)
+    q.state.sync = q.options.sync
+    err = q.load(values, ok)
     if err != nil {
+        q.file.Close()
+        q.state.Close()
         return err
     }
-    data := fmt.Sprintf("%d,%d", q.index, q.offset)
-    buf := new(bytes.Buffer)
-    _ = binary.Write(buf, binary.BigEndian, int32(len(data)))
-    _, err = q.writeFile.Write(bytes.Join([][]byte{[]byte(data), buf.Bytes()}, []byte("")))
-    return err
+    return nil
 }
 
-func (q *FifoDiskQueue) Len() int {
-    return q.index
+func (q *FifoDiskQueue) load(values [4]int64, ok bool) error {
+    stat, err := q.file.Stat()
+    if err != nil {
+        return err
+    }
+    // 记录格式只在新建或为空的队列上按选项确定
+    q.header, q.stamp = q.options.recordHeader(), q.options.recordStamp()
+    if ok {
+        q.index, q.offset, q.end = int(values[0]), int(values[1]), int(values[2])
+        valid := true
+        if q.end > 0 {
+            q.header, q.stamp, valid = recordFormat(values[3])
+        }
+        if !valid || q.index < 0 || q.offset < 0 || q.offset > q.end ||
+            q.index > (q.end-q.offset)/q.record() || int64(q.end) > stat.Size() {
+            return corruptedError("状态 %v 与数据文件大小 %d 不一致", values, stat.Size())
+        }
+    } else {
+        // 没有状态文件时按旧格式读取关闭时写在文件末尾的状态
+        if stat.Size() > 0 {
+            q.header, q.stamp = 4, 0
+            err = q.loadFooter(stat.Size())
+            if err != nil {
+                return err
+            }
+        }
+        err = q.save(q.index, q.offset, q.end)
+        if err != nil {
+            return err
+        }
+    }
+    if stat.Size() > int64(q.end) {
+        err = q.file.Truncate(int64(q.end))
+        if err != nil {
+            return err
+        }
+    }
+    if q.options.retention.MaxAge > 0 && q.stamp == 0 {
+        now := time.Now()
+        for i := 0; i < q.index; i++ {
+            q.times = append(q.times, now)
+        }
+    }
+    return q.retain()
+}
+
+func (q *FifoDiskQueue) loadFooter(size int64) error {
+    if size < 4 {
+        return corruptedError("文件大小 %d 不足以保存状态", size)
+    }
+    buf := make([]byte, 4)
+    _, err := q.file.ReadAt(buf, size-4)
+    if err != nil {
+        return err
+    }
+    length := recordLength(buf)
+    offset := size - 4 - length
+    if length < 0 || length > maxFooterSize || offset < 0 {
+        return corruptedError("状态长度 %d 超出范围", length)
+    }
+    buf = make([]byte, length)
+    _, err = q.file.ReadAt(buf, offset)
+    if err != nil {
+        return err
+    }
+    bufs := strings.Split(string(buf), ",")
+    if len(bufs) != 2 {
+        return corruptedError("状态 %q 格式异常", buf)
+    }
+    indexString := bufs[0]
+    offsetString := bufs[1]
+    q.index, err = strconv.Atoi(indexString)
+    if err != nil || q.index < 0 {
+        return corruptedError("状态 %q 数量异常", buf)
+    }
+    q.offset, err = strconv.Atoi(offsetString)
+    if err != nil || q.offset < 0 || int64(q.offset) > offset {
+        return corruptedError("状态 %q 读取位置超出范围 [0, %d]", buf, offset)
+    }
+    q.end = int(offset)
+    // 旧格式没有校验和，逐条检查数据长度与数量是否一致
+    position := q.offset
+    for i := 0; i < q.index; i++ {
+        length, err := q.length(position)
+        if err != nil {
+            return err
+        }
+        position += q.record() + length
+    }
+    if position != q.end {
+        return corruptedError("%d 条数据与状态 %q 不一致", q.index, buf)
+    }
+    return nil
+}
+
+// 读取 offset 位置数据的长度，长度超出数据结束位置时返回 ErrQueueCorrupted
+func (q *FifoDiskQueue) length(offset int) (int, error) {
+    if offset+q.record() > q.end {
+        return 0, corruptedError("%d 位置超出数据结束位置 %d", offset, q.end)
+    }
+    buf := q.scratch[:q.header]
+    _, err := q.file.ReadAt(buf, int64(offset))
+    if err != nil {
+        return 0, err
+    }
+    length := recordLength(buf)
+    if length < 0 || length > int64(q.end-offset-q.record()) {
+        return 0, corruptedError("%d 位置数据长度 %d 超出范围", offset, length)
+    }
+    return int(length), nil
+}
+
+func (q *FifoDiskQueue) save(index, offset, end int) error {
+    return q.state.save(int64(index), int64(offset), int64(end), int64(q.record()))
+}
+
+// 记录头的字节数
+func (q *FifoDiskQueue) record() int {
+    return q.header + q.stamp
+}
+
+func (q *FifoDiskQueue) pop(length int) {
+    q.index--
+    q.offset += length + q.record()
+    if len(q.times) > 0 {
+        q.times = q.times[1:]
+    }
+}
+
+// 超出保留策略时从读取位置开始跳过最旧的数据
+func (q *FifoDiskQueue) retain() error {
+    retention := q.options.retention
+    index, offset, times := q.index, q.offset, q.times
+    evicted, size := 0, 0
+    for retention.exceeded(q.index, int64(q.end-q.offset), q.oldest) {
+        length, err := q.length(q.offset)
+        if err != nil {
+            q.index, q.offset, q.times = index, offset, times
+            return err
+        }
+        q.pop(length)
+        evicted++
+        size += length
+    }
+    if evicted == 0 {
+        return nil
+    }
+    err := q.save(q.index, q.offset, q.end)
+    if err != nil {
+        q.index, q.offset, q.times = index, offset, times
+        return err
+    }
+    retention.evicted(evicted)
+    q.notify(Event{Type: EventEvicted, Len: q.index, Size: size})
+    return nil
+}
+
+func (q *FifoDiskQueue) oldest() time.Time {
+    if q.stamp > 0 {
+        buf := q.scratch[:q.stamp]
+        if _, err := q.file.ReadAt(buf, int64(q.offset+q.header)); err != nil {
+            return time.Now()
+        }
+        return recordTime(buf)
+    }
+    if len(q.times) == 0 {
+        return time.Now()
+    }
+    return q.times[0]
 }
@@ -7,6 +7,7 @@ import (
     "os"
     "reflect"
     "testing"
+    "time"
 )
 
 func TestNewFifoDiskQueue1(t *testing.T) {
@@ -15,6 +16,7 @@ func TestNewFifoDiskQueue1(t *testing.T) {
         panic(err)
     }
     defer os.RemoveAll(file.Name())
+    defer os.RemoveAll(diskStateFile(file.Name()))
     file.Close()
     queue, err := NewFifoDiskQueue(file.Name())
     if err != nil {
@@ -69,6 +71,7 @@ func TestNewFifoDiskQueue2(t *testing.T) {
         panic(err)
     }
     defer os.RemoveAll(file.Name())
+    defer os.RemoveAll(diskStateFile(file.Name()))
     file.Close()
     queue, err := NewFifoDiskQueue(file.Name())
     if err != nil {
@@ -89,3 +92,87 @@ func TestNewFifoDiskQueue2(t *testing.T) {
         t.Error(name, "非空队列-Get数据返回nil", data, err)
     }
 }
+
+func TestFifoDiskQueueRetention(t *testing.T) {
+    file, err := ioutil.TempFile("", "")
+    if err != nil {
+        panic(err)
+    }
+    defer os.RemoveAll(file.Name())
+    defer os.RemoveAll(diskStateFile(file.Name()))
+    file.Close()
+    name := "TestFifoDiskQueueRetention"
+    evicted := 0
+    queue, err := NewFifoDiskQueue(file.Name(), WithRetention(Retention{
+        MaxItems: 3,
+        MaxBytes: 3 * (4 + 1),
+        OnEvict: func(n int) {
+            evicted += n
+        },
+    }))
+    if err != nil {
+        panic(err)
+    }
+    for i := 0; i < 5; i++ {
+        _ = queue.Put(nil, []byte{byte(i)})
+    }
+    if length := queue.Len(); length != 3 || evicted != 2 {
+        t.Error(name, "超出数量后丢弃最旧数据", length, evicted)
+    }
+    _ = queue.Put(nil, []byte{5, 5})
+    if length := queue.Len(); length != 2 || evicted != 4 {
+        t.Error(name, "超出字节数后丢弃最旧数据", length, evicted)
+    }
+    if data, err := queue.Get(nil); err != nil || !reflect.DeepEqual(data, []byte{4}) {
+        t.Error(name, "丢弃后按序读取", data, err)
+    }
+    _ = queue.Close()
+    queue, err = NewFifoDiskQueue(file.Name(), WithRetention(Retention{MaxAge: time.Millisecond}))
+    if err != nil {
+        panic(err)
+    }
+    defer queue.Close()
+    time.Sleep(time.Millisecond * 2)
+    if data, err := queue.Get(nil); data != nil || !errors.Is(err, ErrQueueEmpty) {
+        t.Error(name, "超过保留时间后丢弃数据", data, err)
+    }
+}
+
+func TestFifoDiskQueueMaxMessageSize(t *testing.T) {
+    name := "TestFifoDiskQueueMaxMessageSize"
+    storage := NewMemoryStorage()
+    queue, err := NewFifoDiskQueue("queue", WithStorage(storage), WithMaxMessageSize(4))
+    if err != nil {
+        panic(err)
+    }
+    if err := queue.Put(nil, []byte("12345")); !errors.Is(err, ErrMessageTooLarge) {
+        t.Error(name, "超出最大长度返回ErrMessageTooLarge", err)
+    }
+    if err := queue.Put(nil, []byte("1234")); err != nil || queue.Len() != 1 {
+        t.Error(name, "未超出最大长度正常写入", err, queue.Len())
+    }
+    _ = queue.Close()
+    // 64 位记录格式，重新打开时不指定选项也沿用原有格式
+    queue, err = NewFifoDiskQueue("large", WithStorage(storage), WithLargeRecords())
+    if err != nil {
+        panic(err)
+    }
+    for _, data := range []string{"a", "bc"} {
+        _ = queue.Put(nil, []byte(data))
+    }
+    _ = queue.Close()
+    if size := len(storage.Bytes("large")); size != 8+1+8+2 {
+        t.Error(name, "64位记录格式文件长度", size)
+    }
+    queue, err = NewFifoDiskQueue("large", WithStorage(storage))
+    if err != nil {
+        panic(err)
+    }
+    _ = queue.Put(nil, []byte("def"))
+    for _, expect := range []string{"a", "bc", "def"} {
+        if data, err := queue.Get(nil); err != nil || string(data) != expect {
+            t.Error(name, "64位记录格式重新打开后按序读取", string(data), err)
+        }
+    }
+    _ = queue.Close()
+}
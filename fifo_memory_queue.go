@@ -2,27 +2,44 @@ package queue
 
 import (
 	"context"
+	"fmt"
+	"sync"
 )
 
+// NewFifoMemoryQueue sizes[0] 为队列容量，默认为 1024
 func NewFifoMemoryQueue(sizes ...int) Queue {
-	ctx, cancel := context.WithCancel(context.Background())
 	size := 1024
 	if len(sizes) > 0 {
 		size = sizes[0]
 	}
+	return NewFifoMemoryQueueWithOptions(size)
+}
+
+// NewFifoMemoryQueueWithOptions size 为队列容量
+func NewFifoMemoryQueueWithOptions(size int, options ...MemoryOption) Queue {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &FifoMemoryQueue{
-		queue:  make(chan []byte, size),
-		ctx:    ctx,
-		cancel: cancel,
+		queue:          make(chan []byte, size),
+		maxMessageSize: newMemoryOptions(options).maxMessageSize,
+		ctx:            ctx,
+		cancel:         cancel,
 	}
 }
 
-var _ Queue = (*FifoMemoryQueue)(nil)
+var _ BufferQueue = (*FifoMemoryQueue)(nil)
+var _ StatsQueue = (*FifoMemoryQueue)(nil)
 
 type FifoMemoryQueue struct {
-	queue  chan []byte
+	// 原子操作的字段放在开头，保证 32 位平台上 8 字节对齐
+	stats          memoryStats
+	queue          chan []byte
+	maxMessageSize int
+	// 事件中的队列长度，与事件通知在同一把锁内更新，保证观察者按顺序看到长度变化
+	events sync.Mutex
+	depth  int
 	ctx    context.Context
 	cancel context.CancelFunc
+	observers
 }
 
 func (q *FifoMemoryQueue) Get(ctx context.Context) ([]byte, error) {
@@ -34,7 +51,7 @@ func (q *FifoMemoryQueue) Get(ctx context.Context) ([]byte, error) {
 	if ctx == nil {
 		select {
 		case data := <-q.queue:
-			return data, nil
+			return q.got(data), nil
 		default:
 			return nil, ErrQueueEmpty
 		}
@@ -45,8 +62,19 @@ func (q *FifoMemoryQueue) Get(ctx context.Context) ([]byte, error) {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	case data := <-q.queue:
-		return data, nil
+		return q.got(data), nil
+	}
+}
+
+// GetInto 将数据复制到 dst，Put 时传入的切片不会被返回
+func (q *FifoMemoryQueue) GetInto(ctx context.Context, dst []byte) ([]byte, error) {
+	data, err := q.Get(ctx)
+	if err != nil {
+		return nil, err
 	}
+	buf := grow(dst, len(data))
+	copy(buf, data)
+	return buf, nil
 }
 
 func (q *FifoMemoryQueue) Put(ctx context.Context, data []byte) error {
@@ -55,29 +83,83 @@ func (q *FifoMemoryQueue) Put(ctx context.Context, data []byte) error {
 		return ErrQueueClosed
 	default:
 	}
+	if q.maxMessageSize > 0 && len(data) > q.maxMessageSize {
+		return fmt.Errorf("%w: %d > %d", ErrMessageTooLarge, len(data), q.maxMessageSize)
+	}
 	if ctx == nil {
 		select {
 		case q.queue <- data:
+			q.sent(data)
 			return nil
 		default:
+			q.notify(Event{Type: EventFull, Len: len(q.queue), Size: len(data)})
 			return ErrQueueFull
 		}
 	}
 	select {
+	case q.queue <- data:
+		q.sent(data)
+		return nil
+	default:
+	}
+	q.notify(Event{Type: EventFull, Len: len(q.queue), Size: len(data)})
+	select {
 	case <-q.ctx.Done():
 		return ErrQueueClosed
 	case <-ctx.Done():
 		return ctx.Err()
 	case q.queue <- data:
+		q.sent(data)
 		return nil
 	}
 }
 
 func (q *FifoMemoryQueue) Close() error {
+	select {
+	case <-q.ctx.Done():
+		return nil
+	default:
+	}
 	q.cancel()
+	q.notify(Event{Type: EventClosed, Len: len(q.queue)})
 	return nil
 }
 
+// 并发 Put/Get 时 chan 操作与通知之间可能穿插其他操作，事件中的长度取自 depth 而不是 len(q.queue)，
+// 所有操作完成后最后一个事件的长度与队列一致
+func (q *FifoMemoryQueue) sent(data []byte) {
+	q.stats.put(len(data))
+	q.events.Lock()
+	defer q.events.Unlock()
+	q.depth++
+	q.notify(Event{Type: EventPut, Len: q.length(), Size: len(data)})
+}
+
+func (q *FifoMemoryQueue) got(data []byte) []byte {
+	q.stats.get(len(data))
+	q.events.Lock()
+	defer q.events.Unlock()
+	q.depth--
+	length := q.length()
+	q.notify(Event{Type: EventGet, Len: length, Size: len(data)})
+	if length == 0 {
+		q.notify(Event{Type: EventEmpty})
+	}
+	return data
+}
+
+// Get 的计数可能先于对应 Put 的计数更新，此时按 0 通知
+func (q *FifoMemoryQueue) length() int {
+	if q.depth < 0 {
+		return 0
+	}
+	return q.depth
+}
+
 func (q *FifoMemoryQueue) Len() int {
 	return len(q.queue)
 }
+
+func (q *FifoMemoryQueue) Stats() Stats {
+	return q.stats.stats(q.ctx.Err() != nil)
+}
@@ -41,3 +41,14 @@ func TestNewFifoMemoryQueuePutClose(t *testing.T) {
 	queue.Close()
 	time.Sleep(time.Millisecond * 2)
 }
+
+func TestFifoMemoryQueueMaxMessageSize(t *testing.T) {
+	name := "TestFifoMemoryQueueMaxMessageSize"
+	queue := NewFifoMemoryQueueWithOptions(8, WithMemoryMaxMessageSize(4))
+	if err := queue.Put(nil, []byte("12345")); !errors.Is(err, ErrMessageTooLarge) || queue.Len() != 0 {
+		t.Error(name, "超出最大长度返回ErrMessageTooLarge", err, queue.Len())
+	}
+	if err := queue.Put(nil, []byte("1234")); err != nil || queue.Len() != 1 {
+		t.Error(name, "未超出最大长度正常写入", err, queue.Len())
+	}
+}
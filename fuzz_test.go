@@ -0,0 +1,70 @@
+//go:build go1.18
+// +build go1.18
+
+package queue
+
+import (
+	"errors"
+	"testing"
+)
+
+// 用正常读写产生的数据文件及状态文件作为语料
+func fuzzSeeds(f *testing.F, newQueue func(file string, options ...DiskOption) (Queue, error)) {
+	storage := NewMemoryStorage()
+	queue, err := newQueue("queue", WithStorage(storage))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		_ = queue.Put(nil, []byte("go-queue")[:i])
+		f.Add(storage.Bytes("queue"), storage.Bytes(diskStateFile("queue")))
+	}
+	_, _ = queue.Get(nil)
+	f.Add(storage.Bytes("queue"), storage.Bytes(diskStateFile("queue")))
+	_ = queue.Close()
+	f.Add(storage.Bytes("queue"), storage.Bytes(diskStateFile("queue")))
+	f.Add(storage.Bytes("queue"), []byte{})
+	f.Add([]byte("\x00\x00\x00\x01a\x00\x00\x00\x01b2,0\x00\x00\x00\x03"), []byte{})
+	f.Add([]byte("a\x00\x00\x00\x01b\x00\x00\x00\x012\x00\x00\x00\x01"), []byte{})
+	f.Add([]byte("\xff\xff\xff\xff"), []byte{})
+}
+
+// 任意文件内容打开及读写都不能 panic，文件损坏时返回 ErrQueueCorrupted 或 IO 错误
+func fuzzDiskQueue(t *testing.T, newQueue func(file string, options ...DiskOption) (Queue, error), data, state []byte) {
+	storage := NewMemoryStorage()
+	storage.SetBytes("queue", data)
+	storage.SetBytes(diskStateFile("queue"), state)
+	queue, err := newQueue("queue", WithStorage(storage))
+	if err != nil {
+		return
+	}
+	defer queue.Close()
+	for queue.Len() > 0 {
+		if _, err := queue.Get(nil); err != nil {
+			if !errors.Is(err, ErrQueueCorrupted) {
+				t.Error("读取损坏文件返回ErrQueueCorrupted", err)
+			}
+			return
+		}
+	}
+	if err := queue.Put(nil, []byte("data")); err != nil {
+		t.Error("读取完后继续写入", err)
+	}
+	if got, err := queue.Get(nil); err != nil || string(got) != "data" {
+		t.Error("读取完后写入的数据", got, err)
+	}
+}
+
+func FuzzFifoDiskQueue(f *testing.F) {
+	fuzzSeeds(f, NewFifoDiskQueue)
+	f.Fuzz(func(t *testing.T, data, state []byte) {
+		fuzzDiskQueue(t, NewFifoDiskQueue, data, state)
+	})
+}
+
+func FuzzLifoDiskQueue(f *testing.F) {
+	fuzzSeeds(f, NewLifoDiskQueue)
+	f.Fuzz(func(t *testing.T, data, state []byte) {
+		fuzzDiskQueue(t, NewLifoDiskQueue, data, state)
+	})
+}
@@ -0,0 +1,60 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+)
+
+// 通知等待中的 Put 接替写入
+var errCommitLeader = errors.New("commit leader")
+
+type commitRequest struct {
+	data []byte
+	done chan error
+}
+
+// groupCommit 合并并发的 Put。同一时刻只有一个 Put 负责写入，其余 Put 排队等待，
+// 负责写入的 Put 将排队的数据连同自己的一次写入，完成后通知同批次的 Put 返回，并交由下一个排队的 Put 负责写入
+type groupCommit struct {
+	lock    sync.Mutex
+	pending []*commitRequest
+	leader  bool
+	flush   func(batch []*commitRequest) error
+}
+
+func newGroupCommit(flush func(batch []*commitRequest) error) *groupCommit {
+	return &groupCommit{flush: flush}
+}
+
+// put 返回时 data 所在的批次已经写入
+func (g *groupCommit) put(data []byte) error {
+	request := &commitRequest{data: data, done: make(chan error, 1)}
+	g.lock.Lock()
+	g.pending = append(g.pending, request)
+	lead := !g.leader
+	g.leader = true
+	g.lock.Unlock()
+	if !lead {
+		if err := <-request.done; err != errCommitLeader {
+			return err
+		}
+	}
+	g.lock.Lock()
+	batch := g.pending
+	g.pending = nil
+	g.lock.Unlock()
+	err := g.flush(batch)
+	for _, r := range batch {
+		if r != request {
+			r.done <- err
+		}
+	}
+	g.lock.Lock()
+	if len(g.pending) > 0 {
+		g.pending[0].done <- errCommitLeader
+	} else {
+		g.leader = false
+	}
+	g.lock.Unlock()
+	return err
+}
@@ -0,0 +1,162 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGroupCommit(t *testing.T) {
+	name := "TestGroupCommit"
+	release := make(chan struct{})
+	var batches [][]*commitRequest
+	g := newGroupCommit(func(batch []*commitRequest) error {
+		batches = append(batches, batch)
+		if len(batches) == 1 {
+			<-release
+		}
+		return nil
+	})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 11; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := g.put([]byte("data")); err != nil {
+				t.Error(name, "合并写入返回nil", err)
+			}
+		}()
+		if i > 0 {
+			continue
+		}
+		// 第一个 Put 写入时阻塞，其余 Put 排队等待
+		for {
+			g.lock.Lock()
+			leader := g.leader && g.pending == nil
+			g.lock.Unlock()
+			if leader {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for {
+		g.lock.Lock()
+		pending := len(g.pending)
+		g.lock.Unlock()
+		if pending == 10 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if len(batches) != 2 || len(batches[0]) != 1 || len(batches[1]) != 10 {
+		t.Error(name, "排队的Put合并为一次写入", len(batches))
+	}
+	if g.leader || g.pending != nil {
+		t.Error(name, "写入完成后没有负责写入的Put", g.leader, g.pending)
+	}
+}
+
+func testDiskQueueGroupCommit(t *testing.T, name string, newQueue func(file string, options ...DiskOption) (Queue, error)) {
+	memory := NewMemoryStorage()
+	storage := NewFaultStorage(memory)
+	queue, err := newQueue("queue", WithStorage(storage), WithGroupCommit(), WithSync())
+	if err != nil {
+		panic(err)
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				data := make([]byte, 8)
+				binary.BigEndian.PutUint64(data, uint64(i*50+j))
+				if err := queue.Put(nil, data); err != nil {
+					t.Error(name, "并发Put返回nil", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if queue.Len() != 1000 || storage.Ops(FaultSync) == 0 {
+		t.Error(name, "并发Put全部写入并Sync", queue.Len(), storage.Ops(FaultSync))
+	}
+	_ = queue.Close()
+	queue, err = newQueue("queue", WithStorage(storage), WithGroupCommit())
+	if err != nil {
+		panic(err)
+	}
+	seen := map[uint64]bool{}
+	for queue.Len() > 0 {
+		data, err := queue.Get(nil)
+		if err != nil {
+			t.Fatal(name, "重新打开后读取数据", err)
+		}
+		seen[binary.BigEndian.Uint64(data)] = true
+	}
+	if len(seen) != 1000 {
+		t.Error(name, "重新打开后数据不丢失不重复", len(seen))
+	}
+	// 写入失败时同一批次的 Put 都返回错误，且数据不可见
+	storage.Inject(Fault{Op: FaultWrite, Times: 1})
+	if err := queue.Put(nil, []byte("data")); !errors.Is(err, ErrInjectedFault) || queue.Len() != 0 {
+		t.Error(name, "写入失败返回错误", err, queue.Len())
+	}
+	if err := queue.Put(nil, bytes.Repeat([]byte("a"), 3)); err != nil || queue.Len() != 1 {
+		t.Error(name, "写入失败后恢复写入", err, queue.Len())
+	}
+	_ = queue.Close()
+	if err := queue.Put(nil, []byte("data")); !errors.Is(err, ErrQueueClosed) {
+		t.Error(name, "关闭后Put返回ErrQueueClosed", err)
+	}
+}
+
+func TestFifoDiskQueueGroupCommit(t *testing.T) {
+	testDiskQueueGroupCommit(t, "TestFifoDiskQueueGroupCommit", NewFifoDiskQueue)
+}
+
+func TestLifoDiskQueueGroupCommit(t *testing.T) {
+	testDiskQueueGroupCommit(t, "TestLifoDiskQueueGroupCommit", NewLifoDiskQueue)
+}
+
+func benchmarkParallelPut(b *testing.B, options ...DiskOption) {
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(file.Name())
+	defer os.RemoveAll(diskStateFile(file.Name()))
+	file.Close()
+	queue, err := NewFifoDiskQueue(file.Name(), options...)
+	if err != nil {
+		panic(err)
+	}
+	defer queue.Close()
+	data := make([]byte, 128)
+	b.ReportAllocs()
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := queue.Put(nil, data); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func BenchmarkFifoDiskQueuePutSync(b *testing.B) {
+	benchmarkParallelPut(b, WithSync())
+}
+
+func BenchmarkFifoDiskQueuePutSyncGroupCommit(b *testing.B) {
+	benchmarkParallelPut(b, WithSync(), WithGroupCommit())
+}
@@ -1,137 +1,300 @@
 package queue
 
 import (
-    "bytes"
     "context"
-    "encoding/binary"
-    "fmt"
     "io"
-    "os"
     "strconv"
     "sync"
+    "time"
 )
 
-func NewLifoDiskQueue(file string) (Queue, error) {
-    var err error
+func NewLifoDiskQueue(file string, options ...DiskOption) (Queue, error) {
     ctx, cancel := context.WithCancel(context.Background())
     queue := LifoDiskQueue{
-        ctx:       ctx,
-        cancel:    cancel,
+        ctx:     ctx,
+        cancel:  cancel,
+        options: newDiskOptions(options),
+    }
+    for _, observer := range queue.options.observers {
+        queue.AddObserver(observer)
     }
-    queue.file, err = os.OpenFile(file, os.O_RDWR|os.O_CREATE, os.ModePerm)
+    err := queue.open(file)
     if err != nil {
         return nil, err
     }
-    stat, err := queue.file.Stat()
+    if queue.options.groupCommit {
+        queue.commits = newGroupCommit(queue.flush)
+    }
+    queue.notify(Event{Type: EventRecovered, Len: queue.index, Size: int(queue.end - queue.start - queue.record()*int64(queue.index))})
+    return &queue, nil
+}
+
+var _ StreamQueue = (*LifoDiskQueue)(nil)
+var _ BufferQueue = (*LifoDiskQueue)(nil)
+var _ StatsQueue = (*LifoDiskQueue)(nil)
+
+// LifoDiskQueue 数据文件中的每条数据为 [数据][int32 长度]，使用 WithLargeRecords 时为 [数据][int64 长度]，
+// 设置了 Retention.MaxAge 时长度之前为 [int64 写入时间]，
+// 数据起止位置等状态在每次 Put/Get 后写入状态文件，进程崩溃后重新打开不会丢失或重复已确认的数据
+type LifoDiskQueue struct {
+    index   int
+    start   int64
+    end     int64
+    // 记录长度字段的字节数，4 或 8
+    header  int
+    // 记录写入时间字段的字节数，0 或 8
+    stamp   int
+    // 打开以来成功的 Put/Get 次数
+    puts    int64
+    gets    int64
+    // 读取记录头时复用，持有锁时使用
+    scratch [16]byte
+    ends    []int64
+    times   []time.Time
+    options diskOptions
+    file    File
+    state   *diskState
+    commits *groupCommit
+    lock    sync.Mutex
+    ctx     context.Context
+    cancel  context.CancelFunc
+    observers
+}
+
+func (q *LifoDiskQueue) Get(ctx context.Context) ([]byte, error) {
+    return q.GetInto(ctx, nil)
+}
+
+func (q *LifoDiskQueue) GetInto(ctx context.Context, dst []byte) ([]byte, error) {
+    select {
+    case <-q.ctx.Done():
+        return nil, ErrQueueClosed
+    default:
+    }
+    q.lock.Lock()
+    defer q.lock.Unlock()
+    err := q.retain()
     if err != nil {
         return nil, err
     }
-    if stat.Size() == 0 {
-        return &queue, nil
+    if q.index <= 0 {
+        return nil, ErrQueueEmpty
     }
-    _, err = queue.file.Seek(-4, io.SeekEnd)
+    end, err := q.previous(q.end)
     if err != nil {
         return nil, err
     }
-    buf := make([]byte, 4)
-    _, err = queue.file.Read(buf)
+    buf := grow(dst, int(q.end-q.record()-end))
+    _, err = q.file.ReadAt(buf, end)
     if err != nil {
         return nil, err
     }
-    var length int32
-    err = binary.Read(bytes.NewBuffer(buf), binary.BigEndian, &length)
+    err = q.consume(end)
     if err != nil {
         return nil, err
     }
-    offset, err := queue.file.Seek(int64(-4-length), io.SeekCurrent)
+    return buf, nil
+}
+
+func (q *LifoDiskQueue) GetWriter(ctx context.Context, w io.Writer) (int64, error) {
+    select {
+    case <-q.ctx.Done():
+        return 0, ErrQueueClosed
+    default:
+    }
+    q.lock.Lock()
+    defer q.lock.Unlock()
+    reader, err := q.reader()
     if err != nil {
-        return nil, err
+        return 0, err
     }
-    buf = make([]byte, length)
-    _, err = queue.file.Read(buf)
+    n, err := copyStream(ctx, w, reader, reader.Size())
     if err != nil {
-        return nil, err
+        return n, err
+    }
+    return n, q.consume(q.end - q.record() - n)
+}
+
+func (q *LifoDiskQueue) GetReader(ctx context.Context) (*RecordReader, error) {
+    select {
+    case <-q.ctx.Done():
+        return nil, ErrQueueClosed
+    default:
     }
-    queue.index, err = strconv.Atoi(string(buf))
+    q.lock.Lock()
+    reader, err := q.reader()
     if err != nil {
+        q.lock.Unlock()
         return nil, err
     }
-    err = queue.file.Truncate(offset)
+    return &RecordReader{reader: reader, ctx: ctx, done: func(read bool) error {
+        defer q.lock.Unlock()
+        if !read {
+            return nil
+        }
+        return q.consume(q.end - q.record() - reader.Size())
+    }}, nil
+}
+
+// 返回最新数据的读取器，队列为空时返回 ErrQueueEmpty
+func (q *LifoDiskQueue) reader() (*io.SectionReader, error) {
+    err := q.retain()
     if err != nil {
         return nil, err
     }
-    _, err = queue.file.Seek(0, io.SeekEnd)
+    if q.index <= 0 {
+        return nil, ErrQueueEmpty
+    }
+    end, err := q.previous(q.end)
     if err != nil {
         return nil, err
     }
-    return &queue, nil
+    return io.NewSectionReader(q.file, end, q.end-q.record()-end), nil
 }
 
-type LifoDiskQueue struct {
-    index     int
-    file      *os.File
-    lock      sync.Mutex
-    ctx       context.Context
-    cancel    context.CancelFunc
+// 移除最新的数据，end 为该数据的起始位置，即移除后的数据结束位置
+func (q *LifoDiskQueue) consume(end int64) error {
+    size := int(q.end - q.record() - end)
+    start := q.start
+    if q.index == 1 {
+        start, end = 0, 0
+    }
+    err := q.save(q.index-1, start, end)
+    if err != nil {
+        return err
+    }
+    q.index--
+    q.gets++
+    q.start, q.end = start, end
+    if q.options.retention.enabled() {
+        q.ends = q.ends[:len(q.ends)-1]
+        q.times = q.times[:len(q.times)-1]
+    }
+    q.notify(Event{Type: EventGet, Len: q.index, Size: size})
+    if q.index == 0 {
+        q.notify(Event{Type: EventEmpty})
+    }
+    return nil
 }
 
-func (q *LifoDiskQueue) Get(ctx context.Context) ([]byte, error) {
+func (q *LifoDiskQueue) Put(ctx context.Context, data []byte) error {
     select {
     case <-q.ctx.Done():
-        return nil, ErrQueueClosed
+        return ErrQueueClosed
     default:
     }
+    // header 打开后不再改变
+    err := q.options.checkSize(int64(len(data)), q.header)
+    if err != nil {
+        return err
+    }
+    if q.commits != nil {
+        return q.commits.put(data)
+    }
     q.lock.Lock()
     defer q.lock.Unlock()
-    if q.index <= 0 {
-        return nil, ErrQueueEmpty
-    }
-    _, err := q.file.Seek(-4, io.SeekCurrent)
+    buf := getBuffer(len(data) + int(q.record()))
+    defer putBuffer(buf)
+    copy(*buf, data)
+    putRecordTime((*buf)[len(data):len(data)+q.stamp], time.Now())
+    putRecordLength((*buf)[len(data)+q.stamp:], len(data))
+    _, err = q.file.WriteAt(*buf, q.end)
     if err != nil {
-        return nil, err
+        return err
     }
-    buf := make([]byte, 4)
-    _, err = q.file.Read(buf)
-    if err != nil {
-        return nil, err
+    return q.commit(len(data))
+}
+
+func (q *LifoDiskQueue) PutReader(ctx context.Context, r io.Reader, size int64) error {
+    select {
+    case <-q.ctx.Done():
+        return ErrQueueClosed
+    default:
     }
-    var length int32
-    err = binary.Read(bytes.NewBuffer(buf), binary.BigEndian, &length)
-    if err != nil {
-        return nil, err
+    if size < 0 {
+        return errNegativeSize
     }
-    _, err = q.file.Seek(int64(-4-length), io.SeekCurrent)
+    q.lock.Lock()
+    defer q.lock.Unlock()
+    err := q.options.checkSize(size, q.header)
     if err != nil {
-        return nil, err
+        return err
     }
-    buf = make([]byte, length)
-    _, err = q.file.Read(buf)
+    _, err = copyStream(ctx, &offsetWriter{file: q.file, offset: q.end}, r, size)
     if err != nil {
-        return nil, err
+        return err
     }
-    _, err = q.file.Seek(int64(-length), io.SeekCurrent)
+    buf := q.scratch[:q.record()]
+    putRecordTime(buf[:q.stamp], time.Now())
+    putRecordLength(buf[q.stamp:], int(size))
+    _, err = q.file.WriteAt(buf, q.end+size)
     if err != nil {
-      return nil, err
+        return err
     }
-    q.index--
-    return buf, nil
+    return q.commit(int(size))
 }
 
-func (q *LifoDiskQueue) Put(ctx context.Context, data []byte) error {
+// 合并写入一批数据
+func (q *LifoDiskQueue) flush(batch []*commitRequest) error {
+    q.lock.Lock()
+    defer q.lock.Unlock()
     select {
     case <-q.ctx.Done():
         return ErrQueueClosed
     default:
     }
-    q.lock.Lock()
-    defer q.lock.Unlock()
-    buf := new(bytes.Buffer)
-    _ = binary.Write(buf, binary.BigEndian, int32(len(data)))
-    _, err := q.file.Write(bytes.Join([][]byte{data, buf.Bytes()}, []byte("")))
+    size := 0
+    lengths := make([]int, len(batch))
+    for i, request := range batch {
+        lengths[i] = len(request.data)
+        size += lengths[i] + int(q.record())
+    }
+    buf := getBuffer(size)
+    defer putBuffer(buf)
+    now := time.Now()
+    position := 0
+    for _, request := range batch {
+        copy((*buf)[position:], request.data)
+        position += len(request.data)
+        putRecordTime((*buf)[position:position+q.stamp], now)
+        position += q.stamp
+        putRecordLength((*buf)[position:position+q.header], len(request.data))
+        position += q.header
+    }
+    _, err := q.file.WriteAt(*buf, q.end)
+    if err != nil {
+        return err
+    }
+    return q.commit(lengths...)
+}
+
+// 数据已写入结束位置之后，保存状态使其可见
+func (q *LifoDiskQueue) commit(lengths ...int) error {
+    err := q.options.syncFile(q.file)
+    if err != nil {
+        return err
+    }
+    end := q.end
+    for _, length := range lengths {
+        end += int64(length) + q.record()
+    }
+    err = q.save(q.index+len(lengths), q.start, end)
     if err != nil {
         return err
     }
-    q.index++
+    now := time.Now()
+    for _, length := range lengths {
+        q.index++
+        q.puts++
+        q.end += int64(length) + q.record()
+        q.notify(Event{Type: EventPut, Len: q.index, Size: length})
+        if q.options.retention.enabled() {
+            q.ends = append(q.ends, q.end)
+            q.times = append(q.times, now)
+        }
+    }
+    // 数据已经写入，丢弃旧数据失败不影响本次 Put，下次操作时重试
+    _ = q.retain()
     return nil
 }
 
@@ -144,25 +307,271 @@ func (q *LifoDiskQueue) Close() error {
     q.lock.Lock()
     defer q.lock.Unlock()
     q.cancel()
-    defer q.file.Close()
+    q.notify(Event{Type: EventClosed, Len: q.index})
+    defer func() {
+        q.file.Close()
+        q.state.Close()
+    }()
     if q.index < 1 {
+        err := q.save(0, 0, 0)
+        if err != nil {
+            return err
+        }
         return q.file.Truncate(0)
     }
-    offset, err := q.file.Seek(0, io.SeekCurrent)
+    return q.file.Truncate(q.end)
+}
+
+func (q *LifoDiskQueue) Len() int {
+    q.lock.Lock()
+    defer q.lock.Unlock()
+    return q.index
+}
+
+func (q *LifoDiskQueue) Stats() Stats {
+    q.lock.Lock()
+    defer q.lock.Unlock()
+    return Stats{
+        Len:         q.index,
+        Bytes:       q.end - q.start,
+        ReadOffset:  q.start,
+        WriteOffset: q.end,
+        Puts:        q.puts,
+        Gets:        q.gets,
+        Closed:      q.ctx.Err() != nil,
+    }
+}
+
+func (q *LifoDiskQueue) open(file string) error {
+    var err error
+    var ok bool
+    var values [4]int64
+    q.file, err = q.options.storage.Open(file)
+    if err != nil {
+        return err
+    }
+    q.state, values, ok, err = openDiskState(q.options.storage, file)
     if err != nil {
+        q.file.Close()
         return err
     }
-    err = q.file.Truncate(offset)
+    q.state.sync = q.options.sync
+    err = q.load(values, ok)
     if err != nil {
+        q.file.Close()
+        q.state.Close()
         return err
     }
-    data := fmt.Sprintf("%d", q.index)
-    buf := new(bytes.Buffer)
-    _ = binary.Write(buf, binary.BigEndian, int32(len(data)))
-    _, err = q.file.Write(bytes.Join([][]byte{[]byte(data), buf.Bytes()}, []byte("")))
-    return err
+    return nil
 }
 
-func (q *LifoDiskQueue) Len() int {
-    return q.index
+func (q *LifoDiskQueue) load(values [4]int64, ok bool) error {
+    stat, err := q.file.Stat()
+    if err != nil {
+        return err
+    }
+    // 记录格式只在新建或为空的队列上按选项确定
+    q.header, q.stamp = q.options.recordHeader(), q.options.recordStamp()
+    if ok {
+        q.index, q.start, q.end = int(values[0]), values[1], values[2]
+        valid := true
+        if q.end > 0 {
+            q.header, q.stamp, valid = recordFormat(values[3])
+        }
+        if !valid || q.index < 0 || q.start < 0 || q.start > q.end ||
+            int64(q.index) > (q.end-q.start)/q.record() || q.end > stat.Size() {
+            return corruptedError("状态 %v 与数据文件大小 %d 不一致", values, stat.Size())
+        }
+    } else {
+        // 没有状态文件时按旧格式读取关闭时写在文件末尾的状态
+        if stat.Size() > 0 {
+            q.header, q.stamp = 4, 0
+            err = q.loadFooter(stat.Size())
+            if err != nil {
+                return err
+            }
+        }
+        err = q.save(q.index, q.start, q.end)
+        if err != nil {
+            return err
+        }
+    }
+    if stat.Size() > q.end {
+        err = q.file.Truncate(q.end)
+        if err != nil {
+            return err
+        }
+    }
+    if !q.options.retention.enabled() {
+        return nil
+    }
+    err = q.loadEnds()
+    if err != nil {
+        return err
+    }
+    return q.retain()
+}
+
+func (q *LifoDiskQueue) loadFooter(size int64) error {
+    if size < 4 {
+        return corruptedError("文件大小 %d 不足以保存状态", size)
+    }
+    buf := make([]byte, 4)
+    _, err := q.file.ReadAt(buf, size-4)
+    if err != nil {
+        return err
+    }
+    length := recordLength(buf)
+    offset := size - 4 - length
+    if length < 0 || length > maxFooterSize || offset < 0 {
+        return corruptedError("状态长度 %d 超出范围", length)
+    }
+    buf = make([]byte, length)
+    _, err = q.file.ReadAt(buf, offset)
+    if err != nil {
+        return err
+    }
+    q.index, err = strconv.Atoi(string(buf))
+    if err != nil || q.index < 0 {
+        return corruptedError("状态 %q 数量异常", buf)
+    }
+    q.end = offset
+    // 旧格式没有校验和，从后向前逐条检查数据长度与数量是否一致
+    position := q.end
+    for i := 0; i < q.index; i++ {
+        position, err = q.previous(position)
+        if err != nil {
+            return err
+        }
+    }
+    if position != 0 {
+        return corruptedError("%d 条数据与状态 %q 不一致", q.index, buf)
+    }
+    return nil
+}
+
+// 返回结束位置为 end 的数据的起始位置，长度超出数据起始位置时返回 ErrQueueCorrupted
+func (q *LifoDiskQueue) previous(end int64) (int64, error) {
+    record := q.record()
+    if end-record < q.start {
+        return 0, corruptedError("%d 位置超出数据起始位置 %d", end, q.start)
+    }
+    buf := q.scratch[:q.header]
+    _, err := q.file.ReadAt(buf, end-int64(q.header))
+    if err != nil {
+        return 0, err
+    }
+    length := recordLength(buf)
+    if length < 0 || length > end-record-q.start {
+        return 0, corruptedError("%d 位置数据长度 %d 超出范围", end, length)
+    }
+    return end - record - length, nil
+}
+
+func (q *LifoDiskQueue) save(index int, start, end int64) error {
+    return q.state.save(int64(index), start, end, q.record())
+}
+
+// 记录头的字节数
+func (q *LifoDiskQueue) record() int64 {
+    return int64(q.header + q.stamp)
+}
+
+// 从数据结束位置向前遍历，记录每条数据的结束位置，用于从最旧的数据开始丢弃
+func (q *LifoDiskQueue) loadEnds() error {
+    q.ends = make([]int64, q.index)
+    q.times = make([]time.Time, q.index)
+    now := time.Now()
+    end := q.end
+    for i := q.index - 1; i >= 0; i-- {
+        q.ends[i] = end
+        q.times[i] = now
+        if q.stamp > 0 {
+            buf := q.scratch[:q.stamp]
+            _, err := q.file.ReadAt(buf, end-q.record())
+            if err != nil {
+                return err
+            }
+            q.times[i] = recordTime(buf)
+        }
+        var err error
+        end, err = q.previous(end)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// 超出保留策略时丢弃最旧的数据，即后移数据起始位置。
+// 丢弃的空间不小于剩余数据时，将剩余数据移动到文件开头，源与目标区域不重叠，移动中断时原数据仍然完整
+func (q *LifoDiskQueue) retain() error {
+    retention := q.options.retention
+    evict := 0
+    for retention.exceeded(q.index-evict, q.end-q.begin(evict), func() time.Time { return q.times[evict] }) {
+        evict++
+    }
+    if evict == 0 {
+        return nil
+    }
+    start := q.begin(evict)
+    err := q.save(q.index-evict, start, q.end)
+    if err != nil {
+        return err
+    }
+    size := start - q.start - q.record()*int64(evict)
+    q.start = start
+    q.ends = q.ends[evict:]
+    q.times = q.times[evict:]
+    q.index -= evict
+    retention.evicted(evict)
+    q.notify(Event{Type: EventEvicted, Len: q.index, Size: int(size)})
+    if q.start < q.end-q.start {
+        return nil
+    }
+    // 丢弃已经保存，移动失败时保留原有位置，下次丢弃时重试
+    _ = q.compact()
+    return nil
+}
+
+func (q *LifoDiskQueue) compact() error {
+    start, end := q.start, q.end
+    buffer := getBuffer(streamBufferSize)
+    defer putBuffer(buffer)
+    buf := *buffer
+    for read := start; read < end; {
+        n, err := q.file.ReadAt(buf[:min64(int64(len(buf)), end-read)], read)
+        if err != nil {
+            return err
+        }
+        _, err = q.file.WriteAt(buf[:n], read-start)
+        if err != nil {
+            return err
+        }
+        read += int64(n)
+    }
+    err := q.save(q.index, 0, end-start)
+    if err != nil {
+        return err
+    }
+    for i := range q.ends {
+        q.ends[i] -= start
+    }
+    q.start, q.end = 0, end-start
+    return q.file.Truncate(q.end)
+}
+
+// 第 i 条数据的起始位置
+func (q *LifoDiskQueue) begin(i int) int64 {
+    if i == 0 {
+        return q.start
+    }
+    return q.ends[i-1]
+}
+
+func min64(a, b int64) int64 {
+    if a < b {
+        return a
+    }
+    return b
 }
@@ -7,6 +7,7 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestNewLifoDiskQueue1(t *testing.T) {
@@ -15,6 +16,7 @@ func TestNewLifoDiskQueue1(t *testing.T) {
 		panic(err)
 	}
 	defer os.RemoveAll(file.Name())
+	defer os.RemoveAll(diskStateFile(file.Name()))
 	file.Close()
 	queue, err := NewLifoDiskQueue(file.Name())
 	if err != nil {
@@ -69,6 +71,7 @@ func TestNewLifoDiskQueue2(t *testing.T) {
 		panic(err)
 	}
 	defer os.RemoveAll(file.Name())
+	defer os.RemoveAll(diskStateFile(file.Name()))
 	file.Close()
 	queue, err := NewLifoDiskQueue(file.Name())
 	if err != nil {
@@ -89,3 +92,94 @@ func TestNewLifoDiskQueue2(t *testing.T) {
 		t.Error(name, "非空队列-Get数据返回nil", data, err)
 	}
 }
+
+func TestLifoDiskQueueRetention(t *testing.T) {
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(file.Name())
+	defer os.RemoveAll(diskStateFile(file.Name()))
+	file.Close()
+	name := "TestLifoDiskQueueRetention"
+	evicted := 0
+	queue, err := NewLifoDiskQueue(file.Name(), WithRetention(Retention{
+		MaxItems: 3,
+		OnEvict: func(n int) {
+			evicted += n
+		},
+	}))
+	if err != nil {
+		panic(err)
+	}
+	for i := 0; i < 5; i++ {
+		_ = queue.Put(nil, []byte{byte(i)})
+	}
+	if length := queue.Len(); length != 3 || evicted != 2 {
+		t.Error(name, "超出数量后丢弃最旧数据", length, evicted)
+	}
+	if data, err := queue.Get(nil); err != nil || !reflect.DeepEqual(data, []byte{4}) {
+		t.Error(name, "丢弃后读取最新数据", data, err)
+	}
+	_ = queue.Close()
+	queue, err = NewLifoDiskQueue(file.Name(), WithRetention(Retention{MaxBytes: 5}))
+	if err != nil {
+		panic(err)
+	}
+	if length := queue.Len(); length != 1 {
+		t.Error(name, "重新打开后按字节数丢弃最旧数据", length)
+	}
+	if data, err := queue.Get(nil); err != nil || !reflect.DeepEqual(data, []byte{3}) {
+		t.Error(name, "保留最新数据", data, err)
+	}
+	_ = queue.Put(nil, []byte{6})
+	_ = queue.Close()
+	queue, err = NewLifoDiskQueue(file.Name(), WithRetention(Retention{MaxAge: time.Millisecond}))
+	if err != nil {
+		panic(err)
+	}
+	defer queue.Close()
+	time.Sleep(time.Millisecond * 2)
+	if data, err := queue.Get(nil); data != nil || !errors.Is(err, ErrQueueEmpty) {
+		t.Error(name, "超过保留时间后丢弃数据", data, err)
+	}
+}
+
+func TestLifoDiskQueueMaxMessageSize(t *testing.T) {
+	name := "TestLifoDiskQueueMaxMessageSize"
+	storage := NewMemoryStorage()
+	queue, err := NewLifoDiskQueue("queue", WithStorage(storage), WithMaxMessageSize(4))
+	if err != nil {
+		panic(err)
+	}
+	if err := queue.Put(nil, []byte("12345")); !errors.Is(err, ErrMessageTooLarge) {
+		t.Error(name, "超出最大长度返回ErrMessageTooLarge", err)
+	}
+	if err := queue.Put(nil, []byte("1234")); err != nil || queue.Len() != 1 {
+		t.Error(name, "未超出最大长度正常写入", err, queue.Len())
+	}
+	_ = queue.Close()
+	// 64 位记录格式，重新打开时不指定选项也沿用原有格式
+	queue, err = NewLifoDiskQueue("large", WithStorage(storage), WithLargeRecords())
+	if err != nil {
+		panic(err)
+	}
+	for _, data := range []string{"a", "bc"} {
+		_ = queue.Put(nil, []byte(data))
+	}
+	_ = queue.Close()
+	if size := len(storage.Bytes("large")); size != 1+8+2+8 {
+		t.Error(name, "64位记录格式文件长度", size)
+	}
+	queue, err = NewLifoDiskQueue("large", WithStorage(storage))
+	if err != nil {
+		panic(err)
+	}
+	_ = queue.Put(nil, []byte("def"))
+	for _, expect := range []string{"def", "bc", "a"} {
+		if data, err := queue.Get(nil); err != nil || string(data) != expect {
+			t.Error(name, "64位记录格式重新打开后按序读取", string(data), err)
+		}
+	}
+	_ = queue.Close()
+}
@@ -2,100 +2,180 @@ package queue
 
 import (
     "context"
+    "fmt"
     "sync"
 )
 
+// NewLifoMemoryQueue sizes[0] 为队列容量，默认为 1024
 func NewLifoMemoryQueue(sizes ...int) Queue {
-    ctx, cancel := context.WithCancel(context.Background())
     size := 1024
     if len(sizes) > 0 {
         size = sizes[0]
     }
+    return NewLifoMemoryQueueWithOptions(size)
+}
+
+// NewLifoMemoryQueueWithOptions size 为队列容量
+func NewLifoMemoryQueueWithOptions(size int, options ...MemoryOption) Queue {
+    ctx, cancel := context.WithCancel(context.Background())
     return &LifoMemoryQueue{
-        queue:     make([][]byte, size, size),
-        ctx:       ctx,
-        cancel:    cancel,
-        putNotify: make(chan struct{}, size),
-        getNotify: make(chan struct{}, size),
+        queue:          make([][]byte, size, size),
+        maxMessageSize: newMemoryOptions(options).maxMessageSize,
+        ctx:            ctx,
+        cancel:         cancel,
     }
 }
 
-var _ Queue = (*LifoMemoryQueue)(nil)
+var _ BufferQueue = (*LifoMemoryQueue)(nil)
+var _ StatsQueue = (*LifoMemoryQueue)(nil)
 
+// LifoMemoryQueue 所有状态由 lock 保护，阻塞的 Get/Put 通过 wait 等待队列状态改变、ctx 取消或队列关闭
 type LifoMemoryQueue struct {
     queue  [][]byte
     ctx    context.Context
     cancel context.CancelFunc
     lock   sync.Mutex
     index  int
-    getNotify chan struct{}
-    putNotify chan struct{}
+    bytes  int64
+    puts   int64
+    gets   int64
+    maxMessageSize int
+    // 有等待者时创建，队列状态改变时关闭并置空，唤醒所有等待者
+    changed chan struct{}
+    observers
 }
 
 func (q *LifoMemoryQueue) Get(ctx context.Context) ([]byte, error) {
-    select {
-    case <-q.ctx.Done():
-        return nil, ErrQueueClosed
-    default:
-    }
-    if ctx != nil {
+    q.lock.Lock()
+    defer q.lock.Unlock()
+    for {
         select {
-        case <-ctx.Done():
-            return nil, ctx.Err()
         case <-q.ctx.Done():
             return nil, ErrQueueClosed
-        case <-q.getNotify: // 阻塞，则表示当前队列无数据
+        default:
+        }
+        if q.index > 0 {
+            break
+        }
+        if ctx == nil {
+            return nil, ErrQueueEmpty
+        }
+        if err := q.wait(ctx); err != nil {
+            return nil, err
         }
-    }
-    q.lock.Lock()
-    defer q.lock.Unlock()
-    if q.index <= 0 {
-        return nil, ErrQueueEmpty
     }
     q.index--
     data := q.queue[q.index]
     q.queue[q.index] = nil
-    <-q.putNotify
-    if ctx == nil {
-        <-q.getNotify
+    q.bytes -= int64(len(data))
+    q.gets++
+    q.broadcast()
+    q.notify(Event{Type: EventGet, Len: q.index, Size: len(data)})
+    if q.index == 0 {
+        q.notify(Event{Type: EventEmpty})
     }
     return data, nil
 }
 
+// GetInto 将数据复制到 dst，Put 时传入的切片不会被返回
+func (q *LifoMemoryQueue) GetInto(ctx context.Context, dst []byte) ([]byte, error) {
+    data, err := q.Get(ctx)
+    if err != nil {
+        return nil, err
+    }
+    buf := grow(dst, len(data))
+    copy(buf, data)
+    return buf, nil
+}
+
 func (q *LifoMemoryQueue) Put(ctx context.Context, data []byte) error {
     select {
     case <-q.ctx.Done():
         return ErrQueueClosed
     default:
     }
-    if ctx != nil {
+    if q.maxMessageSize > 0 && len(data) > q.maxMessageSize {
+        return fmt.Errorf("%w: %d > %d", ErrMessageTooLarge, len(data), q.maxMessageSize)
+    }
+    q.lock.Lock()
+    defer q.lock.Unlock()
+    for full := false; ; full = true {
         select {
-        case <-ctx.Done():
-            return ctx.Err()
         case <-q.ctx.Done():
             return ErrQueueClosed
-        case q.putNotify <- struct{}{}:
+        default:
+        }
+        if q.index < len(q.queue) {
+            break
+        }
+        if !full {
+            q.notify(Event{Type: EventFull, Len: q.index, Size: len(data)})
+        }
+        if ctx == nil {
+            return ErrQueueFull
+        }
+        if err := q.wait(ctx); err != nil {
+            return err
         }
-    }
-    q.lock.Lock()
-    defer q.lock.Unlock()
-    if q.index >= len(q.queue) {
-        return ErrQueueFull
     }
     q.queue[q.index] = data
     q.index++
-    q.getNotify <- struct{}{}
-    if ctx == nil {
-        q.putNotify <- struct{}{}
-    }
+    q.bytes += int64(len(data))
+    q.puts++
+    q.broadcast()
+    q.notify(Event{Type: EventPut, Len: q.index, Size: len(data)})
     return nil
 }
 
 func (q *LifoMemoryQueue) Close() error {
+    q.lock.Lock()
+    defer q.lock.Unlock()
+    select {
+    case <-q.ctx.Done():
+        return nil
+    default:
+    }
+    // 等待者同时等待 q.ctx，取消后全部返回 ErrQueueClosed
     q.cancel()
+    q.notify(Event{Type: EventClosed, Len: q.index})
     return nil
 }
 
 func (q *LifoMemoryQueue) Len() int {
+    q.lock.Lock()
+    defer q.lock.Unlock()
     return q.index
 }
+
+func (q *LifoMemoryQueue) Stats() Stats {
+    q.lock.Lock()
+    defer q.lock.Unlock()
+    return Stats{Len: q.index, Bytes: q.bytes, Puts: q.puts, Gets: q.gets, Closed: q.ctx.Err() != nil}
+}
+
+// wait 持有锁时调用，释放锁直到队列状态改变、ctx 取消或队列关闭，返回时重新持有锁。
+// 返回 nil 时调用方需要重新检查条件
+func (q *LifoMemoryQueue) wait(ctx context.Context) error {
+    if q.changed == nil {
+        q.changed = make(chan struct{})
+    }
+    changed := q.changed
+    q.lock.Unlock()
+    defer q.lock.Lock()
+    select {
+    case <-changed:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-q.ctx.Done():
+        return ErrQueueClosed
+    }
+}
+
+// 持有锁时调用，唤醒所有等待者
+func (q *LifoMemoryQueue) broadcast() {
+    if q.changed != nil {
+        close(q.changed)
+        q.changed = nil
+    }
+}
@@ -3,6 +3,7 @@ package queue
 import (
     "context"
     "errors"
+    "sync"
     "testing"
     "time"
 )
@@ -41,3 +42,125 @@ func TestNewLifoMemoryQueuePutClose(t *testing.T) {
     queue.Close()
     time.Sleep(time.Second)
 }
+
+func TestLifoMemoryQueueMaxMessageSize(t *testing.T) {
+    name := "TestLifoMemoryQueueMaxMessageSize"
+    queue := NewLifoMemoryQueueWithOptions(8, WithMemoryMaxMessageSize(4))
+    if err := queue.Put(nil, []byte("12345")); !errors.Is(err, ErrMessageTooLarge) || queue.Len() != 0 {
+        t.Error(name, "超出最大长度返回ErrMessageTooLarge", err, queue.Len())
+    }
+    if err := queue.Put(nil, []byte("1234")); err != nil || queue.Len() != 1 {
+        t.Error(name, "未超出最大长度正常写入", err, queue.Len())
+    }
+    _ = queue.Close()
+    if err := queue.Put(nil, []byte("12345")); err != ErrQueueClosed {
+        t.Error(name, "关闭后优先返回ErrQueueClosed", err)
+    }
+}
+
+func TestLifoMemoryQueueCloseWakesWaiters(t *testing.T) {
+    name := "TestLifoMemoryQueueCloseWakesWaiters"
+    empty := NewLifoMemoryQueue(1)
+    full := NewLifoMemoryQueue(1)
+    _ = full.Put(nil, []byte("data"))
+    wg := sync.WaitGroup{}
+    for i := 0; i < 10; i++ {
+        wg.Add(2)
+        go func() {
+            defer wg.Done()
+            if _, err := empty.Get(context.Background()); !errors.Is(err, ErrQueueClosed) {
+                t.Error(name, "关闭唤醒阻塞的Get", err)
+            }
+        }()
+        go func() {
+            defer wg.Done()
+            if err := full.Put(context.Background(), []byte("data")); !errors.Is(err, ErrQueueClosed) {
+                t.Error(name, "关闭唤醒阻塞的Put", err)
+            }
+        }()
+    }
+    time.Sleep(time.Millisecond * 10)
+    _ = empty.Close()
+    _ = full.Close()
+    wg.Wait()
+}
+
+func TestLifoMemoryQueueMixedContext(t *testing.T) {
+    name := "TestLifoMemoryQueueMixedContext"
+    queue := NewLifoMemoryQueue(4)
+    counts := make([]int, 8*500)
+    lock := sync.Mutex{}
+    wg := sync.WaitGroup{}
+    for i := 0; i < 8; i++ {
+        wg.Add(2)
+        // 阻塞与非阻塞调用混合，非阻塞调用失败时重试
+        go func(i int) {
+            defer wg.Done()
+            for j := 0; j < 500; j++ {
+                data := []byte{byte(i), byte(j >> 8), byte(j)}
+                if j%2 == 0 {
+                    if err := queue.Put(context.Background(), data); err != nil {
+                        t.Error(name, "阻塞Put返回nil", err)
+                    }
+                    continue
+                }
+                for queue.Put(nil, data) != nil {
+                    time.Sleep(time.Microsecond)
+                }
+            }
+        }(i)
+        go func(i int) {
+            defer wg.Done()
+            for j := 0; j < 500; j++ {
+                var data []byte
+                var err error
+                if (i+j)%2 == 0 {
+                    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+                    data, err = queue.Get(ctx)
+                    cancel()
+                } else {
+                    for data, err = queue.Get(nil); errors.Is(err, ErrQueueEmpty); data, err = queue.Get(nil) {
+                        time.Sleep(time.Microsecond)
+                    }
+                }
+                if err != nil {
+                    t.Error(name, "Get返回nil", err)
+                    return
+                }
+                lock.Lock()
+                counts[int(data[0])*500+(int(data[1])<<8|int(data[2]))]++
+                lock.Unlock()
+            }
+        }(i)
+    }
+    wg.Wait()
+    for i, count := range counts {
+        if count != 1 {
+            t.Fatal(name, "每条数据只读取一次", i, count)
+        }
+    }
+    if length := queue.Len(); length != 0 {
+        t.Error(name, "读取完毕后长度为0", length)
+    }
+}
+
+func TestLifoMemoryQueueCancel(t *testing.T) {
+    name := "TestLifoMemoryQueueCancel"
+    queue := NewLifoMemoryQueue(1)
+    ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+    defer cancel()
+    if _, err := queue.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+        t.Error(name, "超时返回DeadlineExceeded", err)
+    }
+    // 取消的等待者不影响后续调用
+    _ = queue.Put(nil, []byte("a"))
+    if err := queue.Put(ctx, []byte("b")); !errors.Is(err, context.DeadlineExceeded) {
+        t.Error(name, "满队列超时返回DeadlineExceeded", err)
+    }
+    if data, err := queue.Get(context.Background()); string(data) != "a" || err != nil {
+        t.Error(name, "取消后读取数据", string(data), err)
+    }
+    if queue.Len() != 0 {
+        t.Error(name, "取消后长度为0", queue.Len())
+    }
+}
@@ -0,0 +1,538 @@
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrOffsetOutOfRange  = errors.New("offset out of range")
+	ErrUnsupportedOption = errors.New("unsupported option")
+)
+
+const (
+	logFileHeaderSize   = 8
+	logRecordHeaderSize = 12
+)
+
+// NewLogDiskQueue 打开日志型磁盘队列。
+// 数据文件格式为 [int64 首条记录序号] 加若干 [int32 长度][int64 写入时间][数据]，
+// 各消费组的提交位置保存在 file.meta 中。
+// 只支持 WithRetention、WithMaxMessageSize，其他选项返回 ErrUnsupportedOption。
+func NewLogDiskQueue(file string, options ...DiskOption) (*LogDiskQueue, error) {
+	queue := LogDiskQueue{
+		name:    file,
+		options: newDiskOptions(options),
+		groups:  map[string]int64{},
+		cursors: map[string]*LogGroup{},
+	}
+	if err := checkLogOptions(queue.options); err != nil {
+		return nil, err
+	}
+	if err := queue.open(); err != nil {
+		return nil, err
+	}
+	if err := queue.loadMeta(); err != nil {
+		queue.file.Close()
+		return nil, err
+	}
+	queue.retain()
+	return &queue, nil
+}
+
+func checkLogOptions(o diskOptions) error {
+	unsupported := []string{}
+	if _, ok := o.storage.(OSStorage); !ok {
+		unsupported = append(unsupported, "WithStorage")
+	}
+	if len(o.observers) > 0 {
+		unsupported = append(unsupported, "WithObserver")
+	}
+	if o.largeRecords {
+		unsupported = append(unsupported, "WithLargeRecords")
+	}
+	if o.sync {
+		unsupported = append(unsupported, "WithSync")
+	}
+	if o.groupCommit {
+		unsupported = append(unsupported, "WithGroupCommit")
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("%w: LogDiskQueue does not support %s", ErrUnsupportedOption, strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+var _ BufferQueue = (*LogDiskQueue)(nil)
+var _ StatsQueue = (*LogDiskQueue)(nil)
+
+// LogDiskQueue 数据只追加写入，每个消费组独立维护读取位置。
+// 记录在所有消费组都提交越过、或超出保留策略后才会被删除。
+type LogDiskQueue struct {
+	name      string
+	options   diskOptions
+	file      *os.File
+	size      int64
+	fileBase  int64
+	base      int64
+	positions []int64
+	groups    map[string]int64
+	cursors   map[string]*LogGroup
+	lock      sync.Mutex
+	closed    bool
+	// 打开以来成功的 Put/Get 次数，Gets 包括所有消费组
+	puts int64
+	gets int64
+	// 读取记录头时复用，持有锁时使用
+	scratch [logRecordHeaderSize]byte
+}
+
+// Get 使用默认消费组读取数据并自动提交，提交位置在 Close 时持久化
+func (q *LogDiskQueue) Get(ctx context.Context) ([]byte, error) {
+	return q.GetInto(ctx, nil)
+}
+
+func (q *LogDiskQueue) GetInto(ctx context.Context, dst []byte) ([]byte, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+	q.retain()
+	offset, ok := q.groups[""]
+	if !ok || offset < q.base {
+		offset = q.base
+	}
+	if offset >= q.end() {
+		return nil, ErrQueueEmpty
+	}
+	data, err := q.read(offset, dst)
+	if err != nil {
+		return nil, err
+	}
+	q.groups[""] = offset + 1
+	q.gets++
+	q.release()
+	// 读取位置已经推进，压缩失败不影响本次 Get，下次操作时重试
+	_ = q.compact()
+	return data, nil
+}
+
+func (q *LogDiskQueue) Put(ctx context.Context, data []byte) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	// 记录长度固定为 32 位，不支持 WithLargeRecords
+	if err := q.options.checkSize(int64(len(data)), 4); err != nil {
+		return err
+	}
+	buffer := getBuffer(logRecordHeaderSize + len(data))
+	defer putBuffer(buffer)
+	buf := *buffer
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	binary.BigEndian.PutUint64(buf[4:], uint64(time.Now().UnixNano()))
+	copy(buf[logRecordHeaderSize:], data)
+	if _, err := q.file.WriteAt(buf, q.size); err != nil {
+		return err
+	}
+	q.positions = append(q.positions, q.size)
+	q.size += int64(len(buf))
+	q.puts++
+	q.retain()
+	// 记录已经写入，压缩失败不影响本次 Put，下次操作时重试
+	_ = q.compact()
+	return nil
+}
+
+// Len 返回保留中的记录数
+func (q *LogDiskQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return int(q.end() - q.base)
+}
+
+// Stats 返回保留中的记录，读取位置为最早保留的记录在文件中的位置
+func (q *LogDiskQueue) Stats() Stats {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	start := q.position(q.base)
+	return Stats{
+		Len:         int(q.end() - q.base),
+		Bytes:       q.size - start,
+		ReadOffset:  start,
+		WriteOffset: q.size,
+		Puts:        q.puts,
+		Gets:        q.gets,
+		Closed:      q.closed,
+	}
+}
+
+func (q *LogDiskQueue) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	err := q.saveMeta()
+	if e := q.file.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// Group 返回指定消费组的游标，新消费组从最早保留的记录开始读取
+func (q *LogDiskQueue) Group(name string) (*LogGroup, error) {
+	if strings.ContainsAny(name, ",\n") {
+		return nil, fmt.Errorf("invalid group name %q", name)
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+	if cursor, ok := q.cursors[name]; ok {
+		return cursor, nil
+	}
+	committed, ok := q.groups[name]
+	if !ok || committed < q.base {
+		committed = q.base
+	}
+	q.groups[name] = committed
+	cursor := &LogGroup{queue: q, name: name, offset: committed}
+	q.cursors[name] = cursor
+	return cursor, nil
+}
+
+// 第一条保留记录的序号
+func (q *LogDiskQueue) Base() int64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.base
+}
+
+func (q *LogDiskQueue) end() int64 {
+	return q.fileBase + int64(len(q.positions))
+}
+
+func (q *LogDiskQueue) position(offset int64) int64 {
+	index := offset - q.fileBase
+	if index >= int64(len(q.positions)) {
+		return q.size
+	}
+	return q.positions[index]
+}
+
+func (q *LogDiskQueue) read(offset int64, dst []byte) ([]byte, error) {
+	position := q.position(offset)
+	header := q.scratch[:]
+	if _, err := q.file.ReadAt(header, position); err != nil {
+		return nil, err
+	}
+	data := grow(dst, int(binary.BigEndian.Uint32(header)))
+	if _, err := q.file.ReadAt(data, position+logRecordHeaderSize); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// 超出保留策略时丢弃最旧的记录
+func (q *LogDiskQueue) retain() {
+	evicted := 0
+	for q.options.retention.exceeded(int(q.end()-q.base), q.size-q.position(q.base), q.oldest) {
+		q.base++
+		evicted++
+	}
+	q.options.retention.evicted(evicted)
+}
+
+func (q *LogDiskQueue) oldest() time.Time {
+	buf := q.scratch[:8]
+	if _, err := q.file.ReadAt(buf, q.position(q.base)+4); err != nil {
+		return time.Now()
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(buf)))
+}
+
+// 所有消费组都已提交越过的记录可以丢弃
+func (q *LogDiskQueue) release() {
+	if len(q.groups) == 0 {
+		return
+	}
+	min := q.end()
+	for _, committed := range q.groups {
+		if committed < min {
+			min = committed
+		}
+	}
+	if min > q.base {
+		q.base = min
+	}
+}
+
+// 已丢弃数据不少于保留数据时重写文件，回收磁盘空间
+func (q *LogDiskQueue) compact() error {
+	index := q.base - q.fileBase
+	if index <= 0 {
+		return nil
+	}
+	start := q.position(q.base)
+	if start-logFileHeaderSize < q.size-start {
+		return nil
+	}
+	tmp := q.name + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, logFileHeaderSize)
+	binary.BigEndian.PutUint64(header, uint64(q.base))
+	_, err = file.Write(header)
+	if err == nil {
+		_, err = io.Copy(file, io.NewSectionReader(q.file, start, q.size-start))
+	}
+	if err == nil {
+		err = os.Rename(tmp, q.name)
+	}
+	if err != nil {
+		// 原文件保持不变，队列可以继续使用
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	// 重命名后 file 即为新的数据文件
+	q.file.Close()
+	q.file = file
+	shift := start - logFileHeaderSize
+	positions := make([]int64, 0, int64(len(q.positions))-index)
+	for _, position := range q.positions[index:] {
+		positions = append(positions, position-shift)
+	}
+	q.positions = positions
+	q.size -= shift
+	q.fileBase = q.base
+	return q.saveMeta()
+}
+
+func (q *LogDiskQueue) open() error {
+	var err error
+	q.file, err = os.OpenFile(q.name, os.O_RDWR|os.O_CREATE, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	stat, err := q.file.Stat()
+	if err != nil {
+		q.file.Close()
+		return err
+	}
+	q.size = stat.Size()
+	header := make([]byte, logFileHeaderSize)
+	if q.size == 0 {
+		if _, err := q.file.WriteAt(header, 0); err != nil {
+			q.file.Close()
+			return err
+		}
+		q.size = logFileHeaderSize
+		return nil
+	}
+	if _, err := q.file.ReadAt(header, 0); err != nil {
+		q.file.Close()
+		return fmt.Errorf("%s 格式异常: %w", q.name, err)
+	}
+	q.fileBase = int64(binary.BigEndian.Uint64(header))
+	q.base = q.fileBase
+	// 末尾不完整的记录视为写入中断，直接截断。记录头完整时，长度及写入时间需要与正常写入的记录一致，
+	// 否则视为中间的记录损坏，返回 ErrQueueCorrupted，不能截断之后的记录
+	position := int64(logFileHeaderSize)
+	header = make([]byte, logRecordHeaderSize)
+	previous := int64(0)
+	for position+logRecordHeaderSize <= q.size {
+		if _, err := q.file.ReadAt(header, position); err != nil {
+			q.file.Close()
+			return err
+		}
+		length := int64(binary.BigEndian.Uint32(header))
+		written := int64(binary.BigEndian.Uint64(header[4:]))
+		if position+logRecordHeaderSize+length > q.size {
+			if q.options.checkSize(length, 4) != nil || written <= 0 || written < previous {
+				q.file.Close()
+				return corruptedError("%s %d 位置数据长度 %d 超出文件大小 %d", q.name, position, length, q.size)
+			}
+			break
+		}
+		q.positions = append(q.positions, position)
+		position += logRecordHeaderSize + length
+		previous = written
+	}
+	if position != q.size {
+		if err := q.file.Truncate(position); err != nil {
+			q.file.Close()
+			return err
+		}
+		q.size = position
+	}
+	return nil
+}
+
+// meta 文件首行为第一条保留记录的序号，其余每行为 消费组,提交位置
+func (q *LogDiskQueue) loadMeta() error {
+	data, err := ioutil.ReadFile(q.name + ".meta")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	base, err := strconv.ParseInt(lines[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("%s.meta 格式异常: %w", q.name, err)
+	}
+	if base > q.base {
+		q.base = base
+	}
+	if q.base > q.end() {
+		q.base = q.end()
+	}
+	for _, line := range lines[1:] {
+		index := strings.LastIndex(line, ",")
+		if index < 0 {
+			return fmt.Errorf("%s.meta 格式异常: %s", q.name, line)
+		}
+		committed, err := strconv.ParseInt(line[index+1:], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s.meta 格式异常: %w", q.name, err)
+		}
+		if committed > q.end() {
+			committed = q.end()
+		}
+		q.groups[line[:index]] = committed
+	}
+	return nil
+}
+
+func (q *LogDiskQueue) saveMeta() error {
+	names := make([]string, 0, len(q.groups))
+	for name := range q.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf := strings.Builder{}
+	buf.WriteString(fmt.Sprintf("%d\n", q.base))
+	for _, name := range names {
+		buf.WriteString(fmt.Sprintf("%s,%d\n", name, q.groups[name]))
+	}
+	file := q.name + ".meta"
+	if err := ioutil.WriteFile(file+".tmp", []byte(buf.String()), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// LogGroup 消费组游标，Get 只移动本地读取位置，Commit 后才持久化
+type LogGroup struct {
+	queue  *LogDiskQueue
+	name   string
+	offset int64
+}
+
+func (g *LogGroup) Get(ctx context.Context) ([]byte, error) {
+	return g.GetInto(ctx, nil)
+}
+
+func (g *LogGroup) GetInto(ctx context.Context, dst []byte) ([]byte, error) {
+	q := g.queue
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+	q.retain()
+	if g.offset < q.base {
+		g.offset = q.base
+	}
+	if g.offset >= q.end() {
+		return nil, ErrQueueEmpty
+	}
+	data, err := q.read(g.offset, dst)
+	if err != nil {
+		return nil, err
+	}
+	g.offset++
+	q.gets++
+	return data, nil
+}
+
+// Commit 持久化当前读取位置
+func (g *LogGroup) Commit() error {
+	q := g.queue
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	q.groups[g.name] = g.offset
+	q.release()
+	if err := q.saveMeta(); err != nil {
+		return err
+	}
+	// 提交位置已经持久化，压缩失败下次操作时重试
+	_ = q.compact()
+	return nil
+}
+
+// SeekOffset 移动读取位置，用于重放，offset 必须在 [Base, 最新序号] 范围内
+func (g *LogGroup) SeekOffset(offset int64) error {
+	q := g.queue
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if offset < q.base || offset > q.end() {
+		return fmt.Errorf("%w: %d not in [%d, %d]", ErrOffsetOutOfRange, offset, q.base, q.end())
+	}
+	g.offset = offset
+	return nil
+}
+
+func (g *LogGroup) SeekToBeginning() {
+	q := g.queue
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	g.offset = q.base
+}
+
+// Offset 下一条待读取记录的序号
+func (g *LogGroup) Offset() int64 {
+	q := g.queue
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if g.offset < q.base {
+		return q.base
+	}
+	return g.offset
+}
+
+// Len 返回该消费组未读取的记录数
+func (g *LogGroup) Len() int {
+	q := g.queue
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if g.offset < q.base {
+		return int(q.end() - q.base)
+	}
+	return int(q.end() - g.offset)
+}
@@ -0,0 +1,298 @@
+package queue
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewLogDiskQueue(t *testing.T) {
+	name := "TestNewLogDiskQueue"
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "log")
+	queue, err := NewLogDiskQueue(file)
+	if err != nil {
+		panic(err)
+	}
+	if data, err := queue.Get(nil); data != nil || !errors.Is(err, ErrQueueEmpty) {
+		t.Error(name, "空队列-Get数据返回ErrQueueEmpty", data, err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := queue.Put(nil, []byte{byte(i)}); err != nil {
+			t.Error(name, "Put数据返回nil", err)
+		}
+	}
+	a, _ := queue.Group("a")
+	b, _ := queue.Group("b")
+	for i := 0; i < 5; i++ {
+		if data, err := a.Get(nil); err != nil || data[0] != byte(i) {
+			t.Error(name, "消费组a按序读取", i, data, err)
+		}
+	}
+	if err := a.Commit(); err != nil {
+		t.Error(name, "消费组a提交返回nil", err)
+	}
+	if length := queue.Len(); length != 10 {
+		t.Error(name, "消费组b未读取时保留全部记录", length)
+	}
+	if data, err := b.Get(nil); err != nil || data[0] != 0 {
+		t.Error(name, "消费组b独立读取", data, err)
+	}
+	if err := queue.Close(); err != nil {
+		t.Error(name, "队列关闭返回nil", err)
+	}
+	if _, err := a.Get(nil); !errors.Is(err, ErrQueueClosed) {
+		t.Error(name, "关闭队列-Get数据返回ErrQueueClosed", err)
+	}
+
+	queue, err = NewLogDiskQueue(file)
+	if err != nil {
+		panic(err)
+	}
+	a, _ = queue.Group("a")
+	b, _ = queue.Group("b")
+	if offset := a.Offset(); offset != 5 {
+		t.Error(name, "重新打开后恢复消费组a提交位置", offset)
+	}
+	if offset := b.Offset(); offset != 0 {
+		t.Error(name, "未提交的读取位置不恢复", offset)
+	}
+	for i := 0; i < 10; i++ {
+		_, _ = b.Get(nil)
+	}
+	_ = b.Commit()
+	if length := queue.Len(); length != 5 {
+		t.Error(name, "所有消费组越过的记录被删除", length)
+	}
+	if err := a.SeekOffset(2); !errors.Is(err, ErrOffsetOutOfRange) {
+		t.Error(name, "SeekOffset已删除位置返回ErrOffsetOutOfRange", err)
+	}
+	if err := a.SeekOffset(8); err != nil {
+		t.Error(name, "SeekOffset返回nil", err)
+	}
+	if data, err := a.Get(nil); err != nil || data[0] != 8 {
+		t.Error(name, "SeekOffset后读取", data, err)
+	}
+	a.SeekToBeginning()
+	if data, err := a.Get(nil); err != nil || data[0] != 5 {
+		t.Error(name, "SeekToBeginning后重放", data, err)
+	}
+	for i := 0; i < 10; i++ {
+		_, _ = a.Get(nil)
+	}
+	_ = a.Commit()
+	if length := queue.Len(); length != 0 {
+		t.Error(name, "全部提交后队列为空", length)
+	}
+	if stat, _ := os.Stat(file); stat.Size() != logFileHeaderSize {
+		t.Error(name, "全部提交后回收磁盘空间", stat.Size())
+	}
+	_ = queue.Put(nil, []byte{10})
+	_ = queue.Close()
+
+	queue, err = NewLogDiskQueue(file)
+	if err != nil {
+		panic(err)
+	}
+	defer queue.Close()
+	if base := queue.Base(); base != 10 {
+		t.Error(name, "回收后序号连续", base)
+	}
+	a, _ = queue.Group("a")
+	if data, err := a.Get(nil); err != nil || data[0] != 10 {
+		t.Error(name, "回收后继续读取", data, err)
+	}
+}
+
+func TestLogDiskQueueRetention(t *testing.T) {
+	name := "TestLogDiskQueueRetention"
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	queue, err := NewLogDiskQueue(filepath.Join(dir, "log"), WithRetention(Retention{MaxItems: 3}))
+	if err != nil {
+		panic(err)
+	}
+	defer queue.Close()
+	group, _ := queue.Group("slow")
+	for i := 0; i < 10; i++ {
+		_ = queue.Put(nil, []byte{byte(i)})
+	}
+	if length := queue.Len(); length != 3 {
+		t.Error(name, "超出保留数量后丢弃最旧记录", length)
+	}
+	if data, err := group.Get(nil); err != nil || data[0] != 7 {
+		t.Error(name, "落后的消费组跳到最早保留记录", data, err)
+	}
+	if data, err := queue.Get(nil); err != nil || data[0] != 7 {
+		t.Error(name, "默认消费组读取", data, err)
+	}
+}
+
+func TestLogDiskQueueTruncatedRecord(t *testing.T) {
+	name := "TestLogDiskQueueTruncatedRecord"
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "log")
+	queue, _ := NewLogDiskQueue(file)
+	_ = queue.Put(nil, []byte("data"))
+	_ = queue.Put(nil, []byte("data"))
+	_ = queue.Close()
+	stat, _ := os.Stat(file)
+	_ = os.Truncate(file, stat.Size()-1)
+	queue, err = NewLogDiskQueue(file)
+	if err != nil {
+		t.Error(name, "末尾记录不完整时正常打开", err)
+		return
+	}
+	defer queue.Close()
+	if length := queue.Len(); length != 1 {
+		t.Error(name, "截断不完整的记录", length)
+	}
+}
+
+func TestLogDiskQueueCorruptedRecord(t *testing.T) {
+	name := "TestLogDiskQueueCorruptedRecord"
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "log")
+	queue, _ := NewLogDiskQueue(file)
+	_ = queue.Put(nil, []byte("data"))
+	_ = queue.Put(nil, []byte("data"))
+	_ = queue.Close()
+	stat, _ := os.Stat(file)
+	// 第一条记录的长度及写入时间损坏，超出文件大小
+	for _, header := range [][]byte{
+		{0xff, 0xff, 0xff, 0x00},
+		{0x00, 0x00, 0x01, 0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	} {
+		f, err := os.OpenFile(file, os.O_RDWR, 0)
+		if err != nil {
+			panic(err)
+		}
+		_, _ = f.WriteAt(header, logFileHeaderSize)
+		_ = f.Close()
+		if _, err := NewLogDiskQueue(file); !errors.Is(err, ErrQueueCorrupted) {
+			t.Error(name, "中间记录损坏返回ErrQueueCorrupted", header, err)
+		}
+		if size, _ := os.Stat(file); size.Size() != stat.Size() {
+			t.Error(name, "损坏时不截断之后的记录", size.Size())
+		}
+	}
+}
+
+func TestLogDiskQueueRetentionAge(t *testing.T) {
+	name := "TestLogDiskQueueRetentionAge"
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	evicted := 0
+	queue, err := NewLogDiskQueue(filepath.Join(dir, "log"), WithRetention(Retention{
+		MaxAge: time.Millisecond * 20,
+		OnEvict: func(n int) {
+			evicted += n
+		},
+	}))
+	if err != nil {
+		panic(err)
+	}
+	defer queue.Close()
+	_ = queue.Put(nil, []byte{0})
+	_ = queue.Put(nil, []byte{1})
+	time.Sleep(time.Millisecond * 30)
+	_ = queue.Put(nil, []byte{2})
+	if length := queue.Len(); length != 1 || evicted != 2 {
+		t.Error(name, "超过保留时间后丢弃最旧记录", length, evicted)
+	}
+	if data, err := queue.Get(nil); err != nil || data[0] != 2 {
+		t.Error(name, "读取未过期记录", data, err)
+	}
+}
+
+func TestLogDiskQueueCompactError(t *testing.T) {
+	name := "TestLogDiskQueueCompactError"
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "log")
+	queue, err := NewLogDiskQueue(file)
+	if err != nil {
+		panic(err)
+	}
+	// 临时文件路径被目录占用，压缩失败
+	if err := os.Mkdir(file+".tmp", os.ModePerm); err != nil {
+		panic(err)
+	}
+	for _, data := range []string{"a", "b", "c"} {
+		if err := queue.Put(nil, []byte(data)); err != nil {
+			t.Error(name, "Put返回nil", err)
+		}
+	}
+	for _, data := range []string{"a", "b"} {
+		if got, err := queue.Get(nil); string(got) != data || err != nil {
+			t.Error(name, "压缩失败不影响已完成的Get", string(got), err)
+		}
+	}
+	if err := queue.Put(nil, []byte("d")); err != nil {
+		t.Error(name, "压缩失败不影响已完成的Put", err)
+	}
+	_ = os.Remove(file + ".tmp")
+	for _, data := range []string{"c", "d"} {
+		if got, err := queue.Get(nil); string(got) != data || err != nil {
+			t.Error(name, "压缩成功后继续读取", string(got), err)
+		}
+	}
+	_ = queue.Close()
+	queue, err = NewLogDiskQueue(file)
+	if err != nil {
+		panic(err)
+	}
+	defer queue.Close()
+	if length := queue.Len(); length != 0 {
+		t.Error(name, "重新打开后数据已全部读取", length)
+	}
+}
+
+func TestLogDiskQueueUnsupportedOption(t *testing.T) {
+	name := "TestLogDiskQueueUnsupportedOption"
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, option := range []DiskOption{
+		WithStorage(NewMemoryStorage()),
+		WithObserver(NewWatermarkObserver(Watermark{})),
+		WithLargeRecords(),
+		WithSync(),
+		WithGroupCommit(),
+	} {
+		if _, err := NewLogDiskQueue(filepath.Join(dir, "log"), option); !errors.Is(err, ErrUnsupportedOption) {
+			t.Error(name, "不支持的选项返回ErrUnsupportedOption", err)
+		}
+	}
+	queue, err := NewLogDiskQueue(filepath.Join(dir, "log"), WithMaxMessageSize(4), WithRetention(Retention{MaxItems: 1}))
+	if err != nil {
+		t.Fatal(name, "支持的选项", err)
+	}
+	_ = queue.Close()
+}
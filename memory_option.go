@@ -0,0 +1,24 @@
+package queue
+
+// MemoryOption 内存队列选项，用于 NewFifoMemoryQueueWithOptions、NewLifoMemoryQueueWithOptions
+type MemoryOption func(*memoryOptions)
+
+type memoryOptions struct {
+	// 单条数据的最大字节数，0 表示不限制
+	maxMessageSize int
+}
+
+// WithMemoryMaxMessageSize 单条数据的最大字节数，超出时 Put 返回 ErrMessageTooLarge，与磁盘队列的 WithMaxMessageSize 对应
+func WithMemoryMaxMessageSize(size int) MemoryOption {
+	return func(o *memoryOptions) {
+		o.maxMessageSize = size
+	}
+}
+
+func newMemoryOptions(options []MemoryOption) memoryOptions {
+	o := memoryOptions{}
+	for _, option := range options {
+		option(&o)
+	}
+	return o
+}
@@ -0,0 +1,245 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Put 数据大小直方图的桶上限，单位字节
+var payloadBuckets = []int64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+var (
+	instrumentedLock   sync.RWMutex
+	instrumentedQueues = map[string]*InstrumentedQueue{}
+	expvarOnce         sync.Once
+)
+
+// NewInstrumentedQueue 包装任意队列并记录指标，指标通过 expvar 的 queues 变量及 MetricsHandler 暴露。
+// 同名队列后注册的覆盖先注册的，Close 后移除。
+func NewInstrumentedQueue(name string, queue Queue) *InstrumentedQueue {
+	q := &InstrumentedQueue{
+		name:    name,
+		queue:   queue,
+		buckets: make([]int64, len(payloadBuckets)+1),
+	}
+	expvarOnce.Do(func() {
+		expvar.Publish("queues", expvar.Func(func() interface{} {
+			metrics := map[string]Metrics{}
+			for _, q := range instrumented() {
+				metrics[q.name] = q.Metrics()
+			}
+			return metrics
+		}))
+	})
+	instrumentedLock.Lock()
+	instrumentedQueues[name] = q
+	instrumentedLock.Unlock()
+	return q
+}
+
+var _ BufferQueue = (*InstrumentedQueue)(nil)
+var _ StatsQueue = (*InstrumentedQueue)(nil)
+
+type InstrumentedQueue struct {
+	name     string
+	queue    Queue
+	puts     int64
+	gets     int64
+	empty    int64
+	full     int64
+	closed   int64
+	putWait  int64
+	getWait  int64
+	putBytes int64
+	getBytes int64
+	buckets  []int64
+}
+
+type Metrics struct {
+	Puts     int64
+	Gets     int64
+	Empty    int64
+	Full     int64
+	Closed   int64
+	PutWait  time.Duration
+	GetWait  time.Duration
+	PutBytes int64
+	GetBytes int64
+	// 与 payloadBuckets 对应的 Put 数据大小分布，最后一个为超出最大桶的数量
+	PayloadSizes []int64
+	Depth        int
+}
+
+func (q *InstrumentedQueue) Get(ctx context.Context) ([]byte, error) {
+	return q.GetInto(ctx, nil)
+}
+
+func (q *InstrumentedQueue) GetInto(ctx context.Context, dst []byte) ([]byte, error) {
+	start := time.Now()
+	data, err := GetInto(ctx, q.queue, dst)
+	if ctx != nil {
+		atomic.AddInt64(&q.getWait, int64(time.Since(start)))
+	}
+	q.count(err)
+	if err == nil {
+		atomic.AddInt64(&q.gets, 1)
+		atomic.AddInt64(&q.getBytes, int64(len(data)))
+	}
+	return data, err
+}
+
+func (q *InstrumentedQueue) Put(ctx context.Context, data []byte) error {
+	start := time.Now()
+	err := q.queue.Put(ctx, data)
+	if ctx != nil {
+		atomic.AddInt64(&q.putWait, int64(time.Since(start)))
+	}
+	q.count(err)
+	if err == nil {
+		atomic.AddInt64(&q.puts, 1)
+		atomic.AddInt64(&q.putBytes, int64(len(data)))
+		index := sort.Search(len(payloadBuckets), func(i int) bool {
+			return int64(len(data)) <= payloadBuckets[i]
+		})
+		atomic.AddInt64(&q.buckets[index], 1)
+	}
+	return err
+}
+
+func (q *InstrumentedQueue) Len() int {
+	return q.queue.Len()
+}
+
+func (q *InstrumentedQueue) Stats() Stats {
+	return StatsOf(q.queue)
+}
+
+func (q *InstrumentedQueue) Close() error {
+	instrumentedLock.Lock()
+	if instrumentedQueues[q.name] == q {
+		delete(instrumentedQueues, q.name)
+	}
+	instrumentedLock.Unlock()
+	return q.queue.Close()
+}
+
+func (q *InstrumentedQueue) Metrics() Metrics {
+	sizes := make([]int64, len(q.buckets))
+	for i := range q.buckets {
+		sizes[i] = atomic.LoadInt64(&q.buckets[i])
+	}
+	return Metrics{
+		Puts:         atomic.LoadInt64(&q.puts),
+		Gets:         atomic.LoadInt64(&q.gets),
+		Empty:        atomic.LoadInt64(&q.empty),
+		Full:         atomic.LoadInt64(&q.full),
+		Closed:       atomic.LoadInt64(&q.closed),
+		PutWait:      time.Duration(atomic.LoadInt64(&q.putWait)),
+		GetWait:      time.Duration(atomic.LoadInt64(&q.getWait)),
+		PutBytes:     atomic.LoadInt64(&q.putBytes),
+		GetBytes:     atomic.LoadInt64(&q.getBytes),
+		PayloadSizes: sizes,
+		Depth:        q.queue.Len(),
+	}
+}
+
+func (q *InstrumentedQueue) count(err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrQueueEmpty):
+		atomic.AddInt64(&q.empty, 1)
+	case errors.Is(err, ErrQueueFull):
+		atomic.AddInt64(&q.full, 1)
+	case errors.Is(err, ErrQueueClosed):
+		atomic.AddInt64(&q.closed, 1)
+	}
+}
+
+func instrumented() []*InstrumentedQueue {
+	instrumentedLock.RLock()
+	defer instrumentedLock.RUnlock()
+	queues := make([]*InstrumentedQueue, 0, len(instrumentedQueues))
+	for _, q := range instrumentedQueues {
+		queues = append(queues, q)
+	}
+	sort.Slice(queues, func(i, j int) bool {
+		return queues[i].name < queues[j].name
+	})
+	return queues
+}
+
+// MetricsHandler 以 Prometheus 文本格式输出所有 InstrumentedQueue 的指标
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write([]byte(prometheusText(instrumented())))
+	})
+}
+
+func prometheusText(queues []*InstrumentedQueue) string {
+	metrics := make([]Metrics, len(queues))
+	labels := make([]string, len(queues))
+	for i, q := range queues {
+		metrics[i] = q.Metrics()
+		labels[i] = `queue="` + escapeLabel(q.name) + `"`
+	}
+	buf := strings.Builder{}
+	family := func(name, kind, help string, value func(i int) string) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for i := range queues {
+			buf.WriteString(value(i))
+		}
+	}
+	sample := func(name, labels string, value interface{}) string {
+		return fmt.Sprintf("%s{%s} %v\n", name, labels, value)
+	}
+	family("goqueue_puts_total", "counter", "Total successful puts.", func(i int) string {
+		return sample("goqueue_puts_total", labels[i], metrics[i].Puts)
+	})
+	family("goqueue_gets_total", "counter", "Total successful gets.", func(i int) string {
+		return sample("goqueue_gets_total", labels[i], metrics[i].Gets)
+	})
+	family("goqueue_errors_total", "counter", "Total empty, full and closed errors.", func(i int) string {
+		return sample("goqueue_errors_total", labels[i]+`,error="empty"`, metrics[i].Empty) +
+			sample("goqueue_errors_total", labels[i]+`,error="full"`, metrics[i].Full) +
+			sample("goqueue_errors_total", labels[i]+`,error="closed"`, metrics[i].Closed)
+	})
+	family("goqueue_wait_seconds_total", "counter", "Total time spent in blocking calls.", func(i int) string {
+		return sample("goqueue_wait_seconds_total", labels[i]+`,op="put"`, metrics[i].PutWait.Seconds()) +
+			sample("goqueue_wait_seconds_total", labels[i]+`,op="get"`, metrics[i].GetWait.Seconds())
+	})
+	family("goqueue_bytes_total", "counter", "Total payload bytes.", func(i int) string {
+		return sample("goqueue_bytes_total", labels[i]+`,op="put"`, metrics[i].PutBytes) +
+			sample("goqueue_bytes_total", labels[i]+`,op="get"`, metrics[i].GetBytes)
+	})
+	family("goqueue_payload_bytes", "histogram", "Put payload size distribution.", func(i int) string {
+		s, total := "", int64(0)
+		for j, count := range metrics[i].PayloadSizes {
+			total += count
+			le := "+Inf"
+			if j < len(payloadBuckets) {
+				le = strconv.FormatInt(payloadBuckets[j], 10)
+			}
+			s += sample("goqueue_payload_bytes_bucket", labels[i]+`,le="`+le+`"`, total)
+		}
+		return s + sample("goqueue_payload_bytes_sum", labels[i], metrics[i].PutBytes) +
+			sample("goqueue_payload_bytes_count", labels[i], total)
+	})
+	family("goqueue_depth", "gauge", "Current queue length.", func(i int) string {
+		return sample("goqueue_depth", labels[i], metrics[i].Depth)
+	})
+	return buf.String()
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,59 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstrumentedQueue(t *testing.T) {
+	name := "TestInstrumentedQueue"
+	queue := NewInstrumentedQueue("test", NewFifoMemoryQueue(1))
+	_, _ = queue.Get(nil)
+	_ = queue.Put(nil, []byte("data"))
+	_ = queue.Put(nil, []byte("data"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	_ = queue.Put(ctx, make([]byte, 100))
+	cancel()
+	_, _ = queue.Get(context.Background())
+	metrics := queue.Metrics()
+	if metrics.Puts != 1 || metrics.Gets != 1 || metrics.Empty != 1 || metrics.Full != 1 {
+		t.Error(name, "计数", metrics)
+	}
+	if metrics.PutWait < time.Millisecond*10 {
+		t.Error(name, "阻塞等待时间", metrics.PutWait)
+	}
+	if metrics.PutBytes != 4 || metrics.GetBytes != 4 || metrics.PayloadSizes[0] != 1 {
+		t.Error(name, "数据大小", metrics)
+	}
+
+	w := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{
+		`goqueue_puts_total{queue="test"} 1`,
+		`goqueue_errors_total{queue="test",error="full"} 1`,
+		`goqueue_payload_bytes_bucket{queue="test",le="+Inf"} 1`,
+		`goqueue_depth{queue="test"} 0`,
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Error(name, "Prometheus格式输出", line)
+		}
+	}
+
+	vars := map[string]Metrics{}
+	if err := json.Unmarshal([]byte(expvar.Get("queues").String()), &vars); err != nil || vars["test"].Puts != 1 {
+		t.Error(name, "expvar输出", vars, err)
+	}
+	_ = queue.Close()
+	_, _ = queue.Get(nil)
+	if queue.Metrics().Closed != 1 {
+		t.Error(name, "关闭计数", queue.Metrics())
+	}
+	if _, ok := instrumentedQueues["test"]; ok {
+		t.Error(name, "关闭后移除指标")
+	}
+}
@@ -0,0 +1,360 @@
+//go:build linux
+// +build linux
+
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const (
+	defaultSegmentSize = 64 * 1024 * 1024
+	segmentSuffix      = ".segment"
+	// 段内剩余空间不足以写入下一条数据时写入该标记，读取时跳到下一个段
+	segmentEndMarker = math.MaxUint32
+)
+
+// MmapOptions SegmentSize 为每个段文件的大小，默认 64MiB，不能超过 math.MaxUint32，单条数据不能超过 SegmentSize-4。
+// 已有数据的队列沿用创建时的段大小。Copy 为 true 时 Get 返回数据的副本
+type MmapOptions struct {
+	SegmentSize int64
+	Copy        bool
+}
+
+// NewMmapQueue 打开 dir 目录下的内存映射队列，目录不存在时创建
+func NewMmapQueue(dir string, options MmapOptions) (*MmapQueue, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := MmapQueue{
+		dir:      dir,
+		size:     options.SegmentSize,
+		copy:     options.Copy,
+		segments: map[int64][]byte{},
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	if queue.size <= 0 {
+		queue.size = defaultSegmentSize
+	}
+	// 记录长度为 uint32，段更大时长度会被截断
+	if queue.size > math.MaxUint32 {
+		cancel()
+		return nil, fmt.Errorf("segment size %d exceeds %d", queue.size, uint64(math.MaxUint32))
+	}
+	err := queue.open()
+	if err != nil {
+		cancel()
+		queue.unmap(math.MaxInt64)
+		return nil, err
+	}
+	return &queue, nil
+}
+
+var _ BufferQueue = (*MmapQueue)(nil)
+var _ StatsQueue = (*MmapQueue)(nil)
+
+// MmapQueue 基于内存映射的先进先出磁盘队列，数据保存在预分配的段文件中，每条数据为 [uint32 长度][数据]，
+// 数据直接在映射的内存中读写，不需要 read/write 系统调用，读取、写入位置在每次 Put/Get 后写入 dir/queue.state，仍有一次写入。
+// Copy 为 false 时 Get 返回的切片直接指向可写的共享映射，修改会写入段文件，不能修改；
+// 任意 goroutine 的下一次 Get 或 Close 都可能解除映射，之后访问该切片会导致进程崩溃，
+// 因此只适用于单个消费者，多个消费者并发 Get 时应使用 Copy 或 GetInto
+type MmapQueue struct {
+	dir  string
+	size int64
+	copy bool
+	// 数据条数及读取、写入位置，位置为 段序号*段大小+段内偏移
+	index int
+	read  int64
+	write int64
+	// 打开以来成功的 Put/Get 次数
+	puts int64
+	gets int64
+	// 磁盘上最早的段序号
+	first    int64
+	segments map[int64][]byte
+	state    *diskState
+	lock     sync.Mutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+	observers
+}
+
+func (q *MmapQueue) Get(ctx context.Context) ([]byte, error) {
+	select {
+	case <-q.ctx.Done():
+		return nil, ErrQueueClosed
+	default:
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	data, err := q.next()
+	if err != nil || !q.copy {
+		return data, err
+	}
+	buf := make([]byte, len(data))
+	copy(buf, data)
+	return buf, nil
+}
+
+// GetInto 将数据复制到 dst，返回值不指向映射的内存
+func (q *MmapQueue) GetInto(ctx context.Context, dst []byte) ([]byte, error) {
+	select {
+	case <-q.ctx.Done():
+		return nil, ErrQueueClosed
+	default:
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	data, err := q.next()
+	if err != nil {
+		return nil, err
+	}
+	buf := grow(dst, len(data))
+	copy(buf, data)
+	return buf, nil
+}
+
+// 读取并移除下一条数据，返回的切片指向映射的内存
+func (q *MmapQueue) next() ([]byte, error) {
+	// 上一次 Get 返回的数据已经失效，释放读取位置之前的段
+	err := q.release(q.read / q.size)
+	if err != nil {
+		return nil, err
+	}
+	if q.index <= 0 {
+		return nil, ErrQueueEmpty
+	}
+	segment, offset := q.read/q.size, q.read%q.size
+	buf, err := q.segment(segment)
+	if err != nil {
+		return nil, err
+	}
+	if offset+4 > q.size || binary.BigEndian.Uint32(buf[offset:]) == segmentEndMarker {
+		segment, offset = segment+1, 0
+		buf, err = q.segment(segment)
+		if err != nil {
+			return nil, err
+		}
+	}
+	length := int64(binary.BigEndian.Uint32(buf[offset:]))
+	if length > q.size-offset-4 {
+		return nil, corruptedError("段 %d 偏移 %d 数据长度 %d 超出范围", segment, offset, length)
+	}
+	read := segment*q.size + offset + 4 + length
+	err = q.state.save(int64(q.index-1), read, q.write, q.size)
+	if err != nil {
+		return nil, err
+	}
+	q.index--
+	q.read = read
+	q.gets++
+	data := buf[offset+4 : offset+4+length : offset+4+length]
+	q.notify(Event{Type: EventGet, Len: q.index, Size: len(data)})
+	if q.index == 0 {
+		q.notify(Event{Type: EventEmpty})
+	}
+	return data, nil
+}
+
+func (q *MmapQueue) Put(ctx context.Context, data []byte) error {
+	select {
+	case <-q.ctx.Done():
+		return ErrQueueClosed
+	default:
+	}
+	if int64(len(data)) > q.size-4 {
+		return fmt.Errorf("%w: %d > %d", ErrMessageTooLarge, len(data), q.size-4)
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	segment, offset := q.write/q.size, q.write%q.size
+	buf, err := q.segment(segment)
+	if err != nil {
+		return err
+	}
+	if offset+4+int64(len(data)) > q.size {
+		if offset+4 <= q.size {
+			binary.BigEndian.PutUint32(buf[offset:], segmentEndMarker)
+		}
+		segment, offset = segment+1, 0
+		buf, err = q.segment(segment)
+		if err != nil {
+			return err
+		}
+	}
+	binary.BigEndian.PutUint32(buf[offset:], uint32(len(data)))
+	copy(buf[offset+4:], data)
+	write := segment*q.size + offset + 4 + int64(len(data))
+	err = q.state.save(int64(q.index+1), q.read, write, q.size)
+	if err != nil {
+		return err
+	}
+	q.index++
+	q.write = write
+	q.puts++
+	q.notify(Event{Type: EventPut, Len: q.index, Size: len(data)})
+	return nil
+}
+
+func (q *MmapQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.index
+}
+
+// Stats 字节数包括记录头和段末尾未使用的空间
+func (q *MmapQueue) Stats() Stats {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return Stats{
+		Len:         q.index,
+		Bytes:       q.write - q.read,
+		ReadOffset:  q.read,
+		WriteOffset: q.write,
+		Puts:        q.puts,
+		Gets:        q.gets,
+		Closed:      q.ctx.Err() != nil,
+	}
+}
+
+// Close 解除所有映射，之前 Get 返回的切片随之失效
+func (q *MmapQueue) Close() error {
+	select {
+	case <-q.ctx.Done():
+		return nil
+	default:
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.cancel()
+	q.notify(Event{Type: EventClosed, Len: q.index})
+	err := q.unmap(math.MaxInt64)
+	if e := q.state.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+func (q *MmapQueue) open() error {
+	err := os.MkdirAll(q.dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	state, values, ok, err := openDiskState(OSStorage{}, filepath.Join(q.dir, "queue"))
+	if err != nil {
+		return err
+	}
+	q.state = state
+	if ok {
+		q.index, q.read, q.write = int(values[0]), values[1], values[2]
+		if values[3] > 0 {
+			q.size = values[3]
+		}
+		if q.size > math.MaxUint32 || q.index < 0 || q.read < 0 || q.read > q.write || int64(q.index) > (q.write-q.read)/4 {
+			q.state.Close()
+			return corruptedError("状态 %v 异常", values)
+		}
+	} else {
+		err = q.state.save(0, 0, 0, q.size)
+		if err != nil {
+			q.state.Close()
+			return err
+		}
+	}
+	// 删除已经读取完毕但未来得及删除的段
+	files, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		q.state.Close()
+		return err
+	}
+	q.first = q.read / q.size
+	for _, file := range files {
+		segment, err := strconv.ParseInt(strings.TrimSuffix(file.Name(), segmentSuffix), 10, 64)
+		if err != nil || !strings.HasSuffix(file.Name(), segmentSuffix) || segment >= q.first {
+			continue
+		}
+		err = os.Remove(q.segmentFile(segment))
+		if err != nil {
+			q.state.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *MmapQueue) segmentFile(segment int64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", segment, segmentSuffix))
+}
+
+// 返回段的映射，未映射时创建并预分配段文件
+func (q *MmapQueue) segment(segment int64) ([]byte, error) {
+	if buf, ok := q.segments[segment]; ok {
+		return buf, nil
+	}
+	file, err := os.OpenFile(q.segmentFile(segment), os.O_RDWR|os.O_CREATE, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() != q.size {
+		if stat.Size() > q.size {
+			return nil, corruptedError("段文件 %s 大小 %d 超出段大小 %d", file.Name(), stat.Size(), q.size)
+		}
+		err = file.Truncate(q.size)
+		if err != nil {
+			return nil, err
+		}
+	}
+	buf, err := syscall.Mmap(int(file.Fd()), 0, int(q.size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	q.segments[segment] = buf
+	return buf, nil
+}
+
+// 解除 before 之前所有段的映射
+func (q *MmapQueue) unmap(before int64) error {
+	var err error
+	for segment, buf := range q.segments {
+		if segment >= before {
+			continue
+		}
+		if e := syscall.Munmap(buf); err == nil {
+			err = e
+		}
+		delete(q.segments, segment)
+	}
+	return err
+}
+
+// 解除映射并删除 before 之前的段文件
+func (q *MmapQueue) release(before int64) error {
+	if before <= q.first {
+		return nil
+	}
+	err := q.unmap(before)
+	if err != nil {
+		return err
+	}
+	for ; q.first < before; q.first++ {
+		err = os.Remove(q.segmentFile(q.first))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+//go:build linux
+// +build linux
+
+package queue
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMmapQueue(t *testing.T) {
+	name := "TestMmapQueue"
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	queue, err := NewMmapQueue(dir, MmapOptions{SegmentSize: 64})
+	if err != nil {
+		panic(err)
+	}
+	if err := queue.Put(nil, make([]byte, 61)); !errors.Is(err, ErrMessageTooLarge) {
+		t.Error(name, "超出段大小返回ErrMessageTooLarge", err)
+	}
+	// 每个段只能容纳 2 条数据，写入 10 条数据跨越多个段
+	for i := 0; i < 10; i++ {
+		if err := queue.Put(nil, bytes.Repeat([]byte{byte(i)}, 20+i%2)); err != nil {
+			t.Error(name, "写入数据", err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		data, err := queue.Get(nil)
+		if err != nil || !bytes.Equal(data, bytes.Repeat([]byte{byte(i)}, 20+i%2)) {
+			t.Error(name, "按序读取数据", i, data, err)
+		}
+	}
+	if segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix)); len(segments) != 4 {
+		t.Error(name, "删除已读取完毕的段", segments)
+	}
+	_ = queue.Close()
+	if _, err := queue.Get(nil); !errors.Is(err, ErrQueueClosed) {
+		t.Error(name, "关闭后返回ErrQueueClosed", err)
+	}
+
+	// 重新打开时沿用创建时的段大小
+	queue, err = NewMmapQueue(dir, MmapOptions{Copy: true})
+	if err != nil {
+		panic(err)
+	}
+	defer queue.Close()
+	if queue.Len() != 5 {
+		t.Error(name, "重新打开后恢复数据", queue.Len())
+	}
+	_ = queue.Put(nil, []byte("data"))
+	dst := make([]byte, 0, 32)
+	for i := 5; i < 10; i++ {
+		data, err := queue.GetInto(nil, dst)
+		if err != nil || !bytes.Equal(data, bytes.Repeat([]byte{byte(i)}, 20+i%2)) {
+			t.Error(name, "重新打开后按序读取数据", i, data, err)
+		}
+	}
+	if data, err := queue.Get(nil); err != nil || string(data) != "data" {
+		t.Error(name, "读取重新打开后写入的数据", string(data), err)
+	}
+	if data, err := queue.Get(nil); data != nil || !errors.Is(err, ErrQueueEmpty) {
+		t.Error(name, "空队列返回ErrQueueEmpty", data, err)
+	}
+}
+
+func BenchmarkMmapQueueGet(b *testing.B) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	queue, err := NewMmapQueue(dir, MmapOptions{})
+	if err != nil {
+		panic(err)
+	}
+	defer queue.Close()
+	data := make([]byte, 1024)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = queue.Put(nil, data)
+		if _, err := queue.Get(nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMmapQueueStats(t *testing.T) {
+	name := "TestMmapQueueStats"
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	queue, err := NewMmapQueue(dir, MmapOptions{SegmentSize: 64})
+	if err != nil {
+		panic(err)
+	}
+	// 第 3 条数据写入下一个段，位置为跨段的全局位置
+	for i := 0; i < 3; i++ {
+		_ = queue.Put(nil, make([]byte, 20))
+	}
+	_, _ = queue.Get(nil)
+	stats := queue.Stats()
+	if stats.Len != 2 || stats.ReadOffset != 24 || stats.WriteOffset != 88 || stats.Bytes != 64 || stats.Puts != 3 || stats.Gets != 1 || stats.Closed {
+		t.Error(name, "状态", stats)
+	}
+	_ = queue.Close()
+	if stats := queue.Stats(); !stats.Closed || stats.Len != 2 {
+		t.Error(name, "关闭后的状态", stats)
+	}
+}
+
+func TestMmapQueueSegmentSizeLimit(t *testing.T) {
+	name := "TestMmapQueueSegmentSizeLimit"
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	// 记录长度为 uint32，超出时长度会被截断
+	if _, err := NewMmapQueue(dir, MmapOptions{SegmentSize: 1 << 32}); err == nil {
+		t.Error(name, "段大小超过MaxUint32返回错误")
+	}
+	state, _, _, err := openDiskState(OSStorage{}, filepath.Join(dir, "queue"))
+	if err != nil {
+		panic(err)
+	}
+	_ = state.save(0, 0, 0, 1<<33)
+	_ = state.Close()
+	if _, err := NewMmapQueue(dir, MmapOptions{SegmentSize: 64}); !errors.Is(err, ErrQueueCorrupted) {
+		t.Error(name, "状态文件中的段大小超过MaxUint32返回ErrQueueCorrupted", err)
+	}
+}
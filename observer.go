@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type EventType int
+
+const (
+	EventPut EventType = iota + 1
+	EventGet
+	EventFull
+	EventEmpty
+	EventClosed
+	EventRecovered
+	EventEvicted
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPut:
+		return "put"
+	case EventGet:
+		return "get"
+	case EventFull:
+		return "full"
+	case EventEmpty:
+		return "empty"
+	case EventClosed:
+		return "closed"
+	case EventRecovered:
+		return "recovered"
+	case EventEvicted:
+		return "evicted"
+	}
+	return "unknown"
+}
+
+// Event 队列事件，Len 为事件发生后的队列长度，Size 为 Put/Get 的数据大小。
+// EventRecovered 的 Size 为恢复的数据总大小，EventEvicted 的 Size 为保留策略淘汰的数据总大小
+type Event struct {
+	Type EventType
+	Len  int
+	Size int
+}
+
+// Observer 同步回调，回调时可能持有队列锁，不能在回调中调用该队列的方法，耗时操作请使用 AsyncObserver
+type Observer interface {
+	OnEvent(event Event)
+}
+
+type ObserverFunc func(event Event)
+
+func (f ObserverFunc) OnEvent(event Event) {
+	f(event)
+}
+
+// Observable 四种队列均实现了该接口，磁盘队列还可以通过 WithObserver 在打开时注册，以接收 EventRecovered
+type Observable interface {
+	AddObserver(observer Observer)
+}
+
+// AddObserver 为队列注册观察者，队列不支持时返回 false
+func AddObserver(queue Queue, observer Observer) bool {
+	observable, ok := queue.(Observable)
+	if ok {
+		observable.AddObserver(observer)
+	}
+	return ok
+}
+
+type observers struct {
+	lock sync.RWMutex
+	list []Observer
+}
+
+func (o *observers) AddObserver(observer Observer) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.list = append(o.list, observer)
+}
+
+func (o *observers) notify(event Event) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	for _, observer := range o.list {
+		observer.OnEvent(event)
+	}
+}
+
+// NewAsyncObserver 在独立的 goroutine 中按顺序回调 observer，缓冲区满时丢弃事件
+func NewAsyncObserver(observer Observer, buffer int) *AsyncObserver {
+	o := &AsyncObserver{
+		observer: observer,
+		events:   make(chan Event, buffer),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(o.done)
+		for event := range o.events {
+			o.observer.OnEvent(event)
+		}
+	}()
+	return o
+}
+
+var _ Observer = (*AsyncObserver)(nil)
+
+type AsyncObserver struct {
+	observer Observer
+	events   chan Event
+	done     chan struct{}
+	lock     sync.RWMutex
+	closed   bool
+	dropped  int64
+}
+
+func (o *AsyncObserver) OnEvent(event Event) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	if o.closed {
+		return
+	}
+	select {
+	case o.events <- event:
+	default:
+		atomic.AddInt64(&o.dropped, 1)
+	}
+}
+
+// Dropped 缓冲区满时丢弃的事件数
+func (o *AsyncObserver) Dropped() int64 {
+	return atomic.LoadInt64(&o.dropped)
+}
+
+// Close 停止接收事件，并等待已缓冲的事件回调完成
+func (o *AsyncObserver) Close() {
+	o.lock.Lock()
+	if !o.closed {
+		o.closed = true
+		close(o.events)
+	}
+	o.lock.Unlock()
+	<-o.done
+}
@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type eventRecorder struct {
+	lock   sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) OnEvent(event Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) types() []EventType {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	types := []EventType{}
+	for _, event := range r.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestObserverMemoryQueue(t *testing.T) {
+	name := "TestObserverMemoryQueue"
+	for _, queue := range []Queue{NewFifoMemoryQueue(1), NewLifoMemoryQueue(1)} {
+		recorder := &eventRecorder{}
+		if !AddObserver(queue, recorder) {
+			t.Error(name, "内存队列支持观察者")
+		}
+		_ = queue.Put(nil, []byte("data"))
+		_ = queue.Put(nil, []byte("data"))
+		_, _ = queue.Get(nil)
+		_ = queue.Close()
+		_ = queue.Close()
+		expect := []EventType{EventPut, EventFull, EventGet, EventEmpty, EventClosed}
+		if types := recorder.types(); !reflect.DeepEqual(types, expect) {
+			t.Error(name, "事件顺序", types)
+		}
+		if event := recorder.events[0]; event.Len != 1 || event.Size != 4 {
+			t.Error(name, "Put事件", event)
+		}
+	}
+}
+
+func TestObserverDiskQueue(t *testing.T) {
+	name := "TestObserverDiskQueue"
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		panic(err)
+	}
+	_ = file.Close()
+	defer os.RemoveAll(file.Name())
+	defer os.RemoveAll(diskStateFile(file.Name()))
+	queue, err := NewFifoDiskQueue(file.Name())
+	if err != nil {
+		panic(err)
+	}
+	_ = queue.Put(nil, []byte("1"))
+	_ = queue.Put(nil, []byte("2"))
+	_ = queue.Close()
+
+	recorder := &eventRecorder{}
+	queue, err = NewFifoDiskQueue(file.Name(), WithObserver(recorder))
+	if err != nil {
+		panic(err)
+	}
+	_, _ = queue.Get(nil)
+	_ = queue.Close()
+	expect := []EventType{EventRecovered, EventGet, EventClosed}
+	if types := recorder.types(); !reflect.DeepEqual(types, expect) {
+		t.Error(name, "事件顺序", types)
+	}
+	if event := recorder.events[0]; event.Len != 2 {
+		t.Error(name, "恢复事件长度", event)
+	}
+}
+
+func TestAsyncObserver(t *testing.T) {
+	name := "TestAsyncObserver"
+	recorder := &eventRecorder{}
+	block := make(chan struct{})
+	observer := NewAsyncObserver(ObserverFunc(func(event Event) {
+		<-block
+		recorder.OnEvent(event)
+	}), 1)
+	queue := NewFifoMemoryQueue(10)
+	AddObserver(queue, observer)
+	for i := 0; i < 5; i++ {
+		_ = queue.Put(nil, []byte("data"))
+	}
+	close(block)
+	observer.Close()
+	if observer.Dropped() == 0 {
+		t.Error(name, "缓冲区满时丢弃事件")
+	}
+	if n := len(recorder.types()); n == 0 || int64(n)+observer.Dropped() != 5 {
+		t.Error(name, "回调与丢弃数量", n, observer.Dropped())
+	}
+	_ = queue.Close()
+}
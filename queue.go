@@ -3,12 +3,17 @@ package queue
 import (
     "context"
     "errors"
+    "time"
 )
 
 var (
-    ErrQueueClosed = errors.New("queue closed")
-    ErrQueueEmpty  = errors.New("queue empty")
-    ErrQueueFull   = errors.New("queue full")
+    ErrQueueClosed     = errors.New("queue closed")
+    ErrQueueEmpty      = errors.New("queue empty")
+    ErrQueueFull       = errors.New("queue full")
+    // ErrQueueCorrupted 磁盘队列文件损坏，具体原因见包装后的错误信息
+    ErrQueueCorrupted  = errors.New("queue corrupted")
+    // ErrMessageTooLarge 数据超出队列允许的最大字节数
+    ErrMessageTooLarge = errors.New("message too large")
 )
 
 type Queue interface {
@@ -17,3 +22,24 @@ type Queue interface {
     Len() int
     Close() error
 }
+
+// GetWait 阻塞获取数据。磁盘队列的 Get 不支持阻塞，返回 ErrQueueEmpty 时按 interval 轮询，直到拿到数据或 ctx 失效。
+// ctx 为 nil 时不阻塞，interval 不大于 0 时使用默认轮询间隔
+func GetWait(ctx context.Context, queue Queue, interval time.Duration) ([]byte, error) {
+    if interval <= 0 {
+        interval = defaultPollInterval
+    }
+    for {
+        data, err := queue.Get(ctx)
+        if ctx == nil || !errors.Is(err, ErrQueueEmpty) {
+            return data, err
+        }
+        timer := time.NewTimer(interval)
+        select {
+        case <-ctx.Done():
+            timer.Stop()
+            return nil, ctx.Err()
+        case <-timer.C:
+        }
+    }
+}
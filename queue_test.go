@@ -112,3 +112,24 @@ func test_queue(name string, queue Queue, t *testing.T) {
         }
     }
 }
+
+func TestGetWait(t *testing.T) {
+    name := "TestGetWait"
+    queue, err := NewFifoDiskQueue("queue", WithStorage(NewMemoryStorage()))
+    if err != nil {
+        panic(err)
+    }
+    defer queue.Close()
+    if data, err := GetWait(nil, queue, 0); data != nil || !errors.Is(err, ErrQueueEmpty) {
+        t.Error(name, "ctx为nil时不阻塞", data, err)
+    }
+    go func() {
+        time.Sleep(time.Millisecond * 20)
+        _ = queue.Put(nil, []byte("data"))
+    }()
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+    if data, err := GetWait(ctx, queue, 0); err != nil || string(data) != "data" {
+        t.Error(name, "interval为0时按默认间隔轮询", data, err)
+    }
+}
@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package queuetest_test
+
+import (
+	"testing"
+
+	"github.com/czasg/go-queue"
+	"github.com/czasg/go-queue/queuetest"
+)
+
+func TestMmapQueue(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T) queue.Queue {
+		q, err := queue.NewMmapQueue(tempFile(t), queue.MmapOptions{SegmentSize: 64 * 1024, Copy: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q
+	}, queuetest.Options{Order: queuetest.FIFO})
+}
@@ -0,0 +1,371 @@
+// Package queuetest 提供 queue.Queue 的行为一致性测试，可用于检查自定义的队列实现及包装器
+package queuetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/czasg/go-queue"
+)
+
+type Order int
+
+const (
+	// Unordered 只检查数据不丢失、不重复
+	Unordered Order = iota
+	FIFO
+	LIFO
+)
+
+type Options struct {
+	// Capacity 队列容量，0 表示不限容量，跳过满队列相关测试
+	Capacity int
+	Order    Order
+	// Blocking ctx 不为 nil 时 Get/Put 是否阻塞等待，磁盘队列不阻塞
+	Blocking bool
+	// Concurrency 并发测试的生产者、消费者数量，默认为 4
+	Concurrency int
+	// Items 并发测试中每个生产者写入的数量，默认为 100
+	Items int
+}
+
+// NewQueue 每个子测试调用一次，返回一个新的空队列，子测试结束时会关闭该队列
+type NewQueue func(t *testing.T) queue.Queue
+
+// Run 以子测试的形式运行全部行为测试，配合 -race 检查并发安全
+func Run(t *testing.T, newQueue NewQueue, options Options) {
+	if options.Concurrency <= 0 {
+		options.Concurrency = 4
+	}
+	if options.Items <= 0 {
+		options.Items = 100
+	}
+	tests := []struct {
+		name string
+		test func(t *testing.T, q queue.Queue, options Options)
+	}{
+		{"Empty", testEmpty},
+		{"PutGet", testPutGet},
+		{"Order", testOrder},
+		{"Full", testFull},
+		{"Blocking", testBlocking},
+		{"Cancel", testCancel},
+		{"Close", testClose},
+		{"CloseUnblocksGet", testCloseUnblocksGet},
+		{"CloseUnblocksPut", testCloseUnblocksPut},
+		{"Concurrent", testConcurrent},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			q := newQueue(t)
+			defer q.Close()
+			test.test(t, q, options)
+		})
+	}
+}
+
+func testEmpty(t *testing.T, q queue.Queue, options Options) {
+	if length := q.Len(); length != 0 {
+		t.Error("空队列长度为0", length)
+	}
+	if data, err := q.Get(nil); data != nil || !errors.Is(err, queue.ErrQueueEmpty) {
+		t.Error("空队列Get返回ErrQueueEmpty", data, err)
+	}
+}
+
+func testPutGet(t *testing.T, q queue.Queue, options Options) {
+	for _, data := range [][]byte{{}, []byte("go-queue"), bytes.Repeat([]byte{0xff}, 4096)} {
+		if err := q.Put(nil, data); err != nil {
+			t.Error("Put返回nil", err)
+		}
+		if length := q.Len(); length != 1 {
+			t.Error("Put后长度为1", length)
+		}
+		if got, err := q.Get(nil); err != nil || got == nil || !bytes.Equal(got, data) {
+			t.Error("Get返回Put的数据", len(got), err)
+		}
+		if length := q.Len(); length != 0 {
+			t.Error("Get后长度为0", length)
+		}
+	}
+}
+
+func testOrder(t *testing.T, q queue.Queue, options Options) {
+	n := 10
+	if options.Capacity > 0 && options.Capacity < n {
+		n = options.Capacity
+	}
+	for i := 0; i < n; i++ {
+		if err := q.Put(nil, item(i)); err != nil {
+			t.Fatal("Put返回nil", err)
+		}
+	}
+	got := map[int]bool{}
+	for i := 0; i < n; i++ {
+		data, err := q.Get(nil)
+		if err != nil {
+			t.Fatal("Get返回nil", err)
+		}
+		expect := i
+		if options.Order == LIFO {
+			expect = n - 1 - i
+		}
+		if options.Order != Unordered && id(data) != expect {
+			t.Error("获取顺序", i, id(data))
+		}
+		got[id(data)] = true
+	}
+	if len(got) != n {
+		t.Error("数据不丢失不重复", len(got))
+	}
+}
+
+func testFull(t *testing.T, q queue.Queue, options Options) {
+	if options.Capacity <= 0 {
+		t.Skip("不限容量")
+	}
+	for i := 0; i < options.Capacity; i++ {
+		if err := q.Put(nil, item(i)); err != nil {
+			t.Fatal("容量内Put返回nil", i, err)
+		}
+	}
+	if length := q.Len(); length != options.Capacity {
+		t.Error("满队列长度", length)
+	}
+	if err := q.Put(nil, item(-1)); !errors.Is(err, queue.ErrQueueFull) {
+		t.Error("满队列Put返回ErrQueueFull", err)
+	}
+	if options.Blocking {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+		if err := q.Put(ctx, item(-1)); !errors.Is(err, context.DeadlineExceeded) {
+			t.Error("满队列阻塞Put直到ctx超时", err)
+		}
+	}
+	if length := q.Len(); length != options.Capacity {
+		t.Error("Put失败后长度不变", length)
+	}
+	if _, err := q.Get(nil); err != nil {
+		t.Error("满队列Get返回nil", err)
+	}
+	if err := q.Put(nil, item(-1)); err != nil {
+		t.Error("Get后可以继续Put", err)
+	}
+}
+
+func testBlocking(t *testing.T, q queue.Queue, options Options) {
+	if !options.Blocking {
+		t.Skip("不支持阻塞")
+	}
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		_ = q.Put(nil, item(1))
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if data, err := q.Get(ctx); err != nil || id(data) != 1 {
+		t.Error("阻塞Get等待Put的数据", data, err)
+	}
+	if options.Capacity <= 0 {
+		return
+	}
+	for i := 0; i < options.Capacity; i++ {
+		_ = q.Put(nil, item(i))
+	}
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		_, _ = q.Get(nil)
+	}()
+	if err := q.Put(ctx, item(-1)); err != nil {
+		t.Error("满队列阻塞Put等待Get后写入", err)
+	}
+	if length := q.Len(); length != options.Capacity {
+		t.Error("阻塞Put后长度", length)
+	}
+}
+
+func testCancel(t *testing.T, q queue.Queue, options Options) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if options.Blocking {
+		if data, err := q.Get(ctx); data != nil || !errors.Is(err, context.Canceled) {
+			t.Error("ctx已取消时阻塞Get返回ctx.Err()", data, err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+		start := time.Now()
+		if data, err := q.Get(ctx); data != nil || !errors.Is(err, context.DeadlineExceeded) {
+			t.Error("空队列阻塞Get直到ctx超时", data, err)
+		}
+		if elapsed := time.Since(start); elapsed < time.Millisecond*10 {
+			t.Error("ctx超时前返回", elapsed)
+		}
+	} else if data, err := q.Get(ctx); data != nil || err == nil {
+		t.Error("空队列Get返回错误", data, err)
+	}
+	if err := q.Put(nil, item(1)); err != nil {
+		t.Error("ctx取消后队列可继续使用", err)
+	}
+	if data, err := q.Get(nil); err != nil || id(data) != 1 {
+		t.Error("ctx取消不影响已有数据", data, err)
+	}
+}
+
+func testClose(t *testing.T, q queue.Queue, options Options) {
+	_ = q.Put(nil, item(1))
+	if err := q.Close(); err != nil {
+		t.Error("Close返回nil", err)
+	}
+	if err := q.Close(); err != nil {
+		t.Error("重复Close返回nil", err)
+	}
+	if data, err := q.Get(nil); data != nil || !errors.Is(err, queue.ErrQueueClosed) {
+		t.Error("关闭后Get返回ErrQueueClosed", data, err)
+	}
+	if data, err := q.Get(context.Background()); data != nil || !errors.Is(err, queue.ErrQueueClosed) {
+		t.Error("关闭后阻塞Get返回ErrQueueClosed", data, err)
+	}
+	if err := q.Put(nil, item(1)); !errors.Is(err, queue.ErrQueueClosed) {
+		t.Error("关闭后Put返回ErrQueueClosed", err)
+	}
+	if err := q.Put(context.Background(), item(1)); !errors.Is(err, queue.ErrQueueClosed) {
+		t.Error("关闭后阻塞Put返回ErrQueueClosed", err)
+	}
+}
+
+func testCloseUnblocksGet(t *testing.T, q queue.Queue, options Options) {
+	if !options.Blocking {
+		t.Skip("不支持阻塞")
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if data, err := q.Get(context.Background()); data != nil || !errors.Is(err, queue.ErrQueueClosed) {
+			t.Error("关闭时阻塞中的Get返回ErrQueueClosed", data, err)
+		}
+	}()
+	time.Sleep(time.Millisecond * 10)
+	_ = q.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Error("关闭后阻塞中的Get未返回")
+	}
+}
+
+func testCloseUnblocksPut(t *testing.T, q queue.Queue, options Options) {
+	if !options.Blocking || options.Capacity <= 0 {
+		t.Skip("不支持阻塞或不限容量")
+	}
+	for i := 0; i < options.Capacity; i++ {
+		_ = q.Put(nil, item(i))
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := q.Put(context.Background(), item(-1)); !errors.Is(err, queue.ErrQueueClosed) {
+			t.Error("关闭时阻塞中的Put返回ErrQueueClosed", err)
+		}
+	}()
+	time.Sleep(time.Millisecond * 10)
+	_ = q.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Error("关闭后阻塞中的Put未返回")
+	}
+}
+
+func testConcurrent(t *testing.T, q queue.Queue, options Options) {
+	total := options.Concurrency * options.Items
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	wg := sync.WaitGroup{}
+	for p := 0; p < options.Concurrency; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < options.Items; i++ {
+				if err := put(ctx, q, item(p*options.Items+i), options); err != nil {
+					t.Error("并发Put", err)
+					return
+				}
+			}
+		}(p)
+	}
+	lock := sync.Mutex{}
+	got := map[int]int{}
+	received := 0
+	for c := 0; c < options.Concurrency; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				lock.Lock()
+				if received >= total {
+					lock.Unlock()
+					return
+				}
+				received++
+				lock.Unlock()
+				data, err := queue.GetWait(ctx, q, time.Millisecond)
+				if err != nil {
+					t.Error("并发Get", err)
+					return
+				}
+				lock.Lock()
+				got[id(data)]++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(got) != total {
+		t.Error("并发读写数据不丢失", len(got), total)
+	}
+	for i, count := range got {
+		if count != 1 {
+			t.Error("并发读写数据不重复", i, count)
+		}
+	}
+	if length := q.Len(); length != 0 {
+		t.Error("并发读写后长度为0", length)
+	}
+}
+
+// 非阻塞队列满时轮询重试
+func put(ctx context.Context, q queue.Queue, data []byte, options Options) error {
+	if options.Blocking {
+		return q.Put(ctx, data)
+	}
+	for {
+		err := q.Put(nil, data)
+		if !errors.Is(err, queue.ErrQueueFull) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func item(i int) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(int64(i)))
+	return buf
+}
+
+func id(data []byte) int {
+	if len(data) != 8 {
+		return -2
+	}
+	return int(int64(binary.BigEndian.Uint64(data)))
+}
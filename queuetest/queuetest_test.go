@@ -0,0 +1,102 @@
+package queuetest_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/czasg/go-queue"
+	"github.com/czasg/go-queue/queuetest"
+)
+
+func tempFile(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	return filepath.Join(dir, "queue")
+}
+
+func TestFifoMemoryQueue(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T) queue.Queue {
+		return queue.NewFifoMemoryQueue(16)
+	}, queuetest.Options{Capacity: 16, Order: queuetest.FIFO, Blocking: true})
+}
+
+func TestLifoMemoryQueue(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T) queue.Queue {
+		return queue.NewLifoMemoryQueue(16)
+	}, queuetest.Options{Capacity: 16, Order: queuetest.LIFO, Blocking: true})
+}
+
+func TestRingQueue(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T) queue.Queue {
+		return queue.NewRingQueue(16)
+	}, queuetest.Options{Capacity: 16, Order: queuetest.FIFO, Blocking: true})
+}
+
+func TestFifoDiskQueue(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T) queue.Queue {
+		q, err := queue.NewFifoDiskQueue(tempFile(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q
+	}, queuetest.Options{Order: queuetest.FIFO})
+}
+
+func TestLifoDiskQueue(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T) queue.Queue {
+		q, err := queue.NewLifoDiskQueue(tempFile(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q
+	}, queuetest.Options{Order: queuetest.LIFO})
+}
+
+func TestFifoDiskQueueGroupCommit(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T) queue.Queue {
+		q, err := queue.NewFifoDiskQueue(tempFile(t), queue.WithGroupCommit(), queue.WithSync())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q
+	}, queuetest.Options{Order: queuetest.FIFO})
+}
+
+func TestLifoDiskQueueGroupCommit(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T) queue.Queue {
+		q, err := queue.NewLifoDiskQueue(tempFile(t), queue.WithGroupCommit(), queue.WithSync())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q
+	}, queuetest.Options{Order: queuetest.LIFO})
+}
+
+func TestLogDiskQueue(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T) queue.Queue {
+		q, err := queue.NewLogDiskQueue(tempFile(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q
+	}, queuetest.Options{Order: queuetest.FIFO})
+}
+
+func TestInstrumentedQueue(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T) queue.Queue {
+		return queue.NewInstrumentedQueue(t.Name(), queue.NewFifoMemoryQueue(16))
+	}, queuetest.Options{Capacity: 16, Order: queuetest.FIFO, Blocking: true})
+}
+
+func TestRateLimitedQueue(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T) queue.Queue {
+		return queue.NewRateLimitedQueue(queue.NewLifoMemoryQueue(16), queue.Limit{}, queue.Limit{Rate: 1e6, Burst: 1000})
+	}, queuetest.Options{Capacity: 16, Order: queuetest.LIFO, Blocking: true})
+}
@@ -0,0 +1,140 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited 非阻塞调用时令牌不足
+var ErrRateLimited = errors.New("rate limited")
+
+// Limit 令牌桶限速，Rate 为每秒生成的令牌数，Burst 为桶容量，Rate 为 0 表示不限速
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// NewRateLimitedQueue 包装任意队列，分别对 Get 和 Put 限速。
+// ctx 为 nil 时令牌不足返回 ErrRateLimited，否则等待令牌直到 ctx 失效。
+// 每次成功的 Get/Put 消耗一个令牌，失败时归还。
+func NewRateLimitedQueue(queue Queue, get, put Limit) *RateLimitedQueue {
+	return &RateLimitedQueue{
+		queue: queue,
+		get:   newTokenBucket(get),
+		put:   newTokenBucket(put),
+	}
+}
+
+var _ BufferQueue = (*RateLimitedQueue)(nil)
+var _ StatsQueue = (*RateLimitedQueue)(nil)
+
+type RateLimitedQueue struct {
+	queue Queue
+	get   *tokenBucket
+	put   *tokenBucket
+}
+
+func (q *RateLimitedQueue) Get(ctx context.Context) ([]byte, error) {
+	return q.GetInto(ctx, nil)
+}
+
+func (q *RateLimitedQueue) GetInto(ctx context.Context, dst []byte) ([]byte, error) {
+	if err := q.get.take(ctx); err != nil {
+		return nil, err
+	}
+	data, err := GetInto(ctx, q.queue, dst)
+	if err != nil {
+		q.get.refund()
+	}
+	return data, err
+}
+
+func (q *RateLimitedQueue) Put(ctx context.Context, data []byte) error {
+	if err := q.put.take(ctx); err != nil {
+		return err
+	}
+	err := q.queue.Put(ctx, data)
+	if err != nil {
+		q.put.refund()
+	}
+	return err
+}
+
+func (q *RateLimitedQueue) Len() int {
+	return q.queue.Len()
+}
+
+func (q *RateLimitedQueue) Stats() Stats {
+	return StatsOf(q.queue)
+}
+
+func (q *RateLimitedQueue) Close() error {
+	return q.queue.Close()
+}
+
+func newTokenBucket(limit Limit) *tokenBucket {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &tokenBucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   time.Now(),
+	}
+}
+
+type tokenBucket struct {
+	limit  Limit
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// take 获取一个令牌，ctx 不为 nil 时先预占令牌再等待，等待期间 ctx 失效则归还
+func (b *tokenBucket) take(ctx context.Context) error {
+	if b.limit.Rate <= 0 {
+		return nil
+	}
+	b.lock.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		b.lock.Unlock()
+		return nil
+	}
+	if ctx == nil {
+		b.lock.Unlock()
+		return ErrRateLimited
+	}
+	wait := time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+	b.tokens--
+	b.lock.Unlock()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		b.refund()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (b *tokenBucket) refund() {
+	if b.limit.Rate <= 0 {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.tokens++
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+}
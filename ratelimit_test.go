@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedQueue(t *testing.T) {
+	name := "TestRateLimitedQueue"
+	queue := NewRateLimitedQueue(NewFifoMemoryQueue(100), Limit{}, Limit{Rate: 10, Burst: 2})
+	for i := 0; i < 2; i++ {
+		if err := queue.Put(nil, []byte("data")); err != nil {
+			t.Error(name, "突发容量内写入", err)
+		}
+	}
+	if err := queue.Put(nil, []byte("data")); err != ErrRateLimited {
+		t.Error(name, "非阻塞写入超出速率", err)
+	}
+	start := time.Now()
+	if err := queue.Put(context.Background(), []byte("data")); err != nil {
+		t.Error(name, "阻塞等待令牌", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond*50 {
+		t.Error(name, "等待令牌时间", elapsed)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := queue.Get(nil); err != nil {
+			t.Error(name, "Get不限速", err)
+		}
+	}
+	if queue.Len() != 0 {
+		t.Error(name, "队列长度", queue.Len())
+	}
+	_ = queue.Close()
+}
+
+func TestRateLimitedQueueCancel(t *testing.T) {
+	name := "TestRateLimitedQueueCancel"
+	queue := NewRateLimitedQueue(NewFifoMemoryQueue(100), Limit{Rate: 1}, Limit{})
+	_ = queue.Put(nil, []byte("data"))
+	if _, err := queue.Get(nil); err != nil {
+		t.Error(name, "获取数据", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if _, err := queue.Get(ctx); err != context.DeadlineExceeded {
+		t.Error(name, "等待令牌时ctx超时", err)
+	}
+	_ = queue.Put(nil, []byte("data"))
+	if _, err := queue.Get(nil); err != ErrRateLimited {
+		t.Error(name, "ctx超时后归还令牌但仍未生成新令牌", err)
+	}
+
+	empty := NewRateLimitedQueue(NewFifoMemoryQueue(100), Limit{Rate: 1}, Limit{})
+	if _, err := empty.Get(nil); err != ErrQueueEmpty {
+		t.Error(name, "空队列", err)
+	}
+	if _, err := empty.Get(nil); err != ErrQueueEmpty {
+		t.Error(name, "空队列归还令牌", err)
+	}
+	_ = queue.Close()
+	_ = empty.Close()
+}
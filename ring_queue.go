@@ -0,0 +1,228 @@
+package queue
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// NewRingQueue 无锁的多生产者多消费者先进先出内存队列，容量向上取整为 2 的幂，默认为 1024。
+// 非阻塞的 Put/Get 只使用原子操作，适用于生产者、消费者较多的场景，不支持观察者
+func NewRingQueue(sizes ...int) *RingQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	size := 1024
+	if len(sizes) > 0 && sizes[0] > 0 {
+		size = sizes[0]
+	}
+	capacity := 1
+	for capacity < size {
+		capacity <<= 1
+	}
+	q := &RingQueue{
+		mask:      uint64(capacity - 1),
+		cells:     make([]ringCell, capacity),
+		getSignal: make(chan struct{}, 1),
+		putSignal: make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	for i := range q.cells {
+		q.cells[i].sequence = uint64(i)
+	}
+	return q
+}
+
+var _ BufferQueue = (*RingQueue)(nil)
+var _ StatsQueue = (*RingQueue)(nil)
+
+// 每个槽位的 sequence 等于写入位置时可以写入，等于写入位置+1 时可以读取，读取后推进一圈
+type ringCell struct {
+	sequence uint64
+	data     []byte
+}
+
+// RingQueue 基于 Dmitry Vyukov 的有界 MPMC 队列，写入、读取位置分别位于独立的缓存行，避免伪共享。
+// 阻塞的 Put/Get 在队列满、空时等待信号，成功的 Put/Get 只在有等待者时发送信号
+type RingQueue struct {
+	enqueue uint64
+	_       [56]byte
+	dequeue uint64
+	_       [56]byte
+	mask    uint64
+	// 队列中数据的总字节数，位于 8 字节对齐的位置，用于原子操作
+	bytes int64
+	cells []ringCell
+	// 等待中的 Get/Put 数量
+	getWaiters int32
+	putWaiters int32
+	getSignal  chan struct{}
+	putSignal  chan struct{}
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+func (q *RingQueue) Get(ctx context.Context) ([]byte, error) {
+	select {
+	case <-q.ctx.Done():
+		return nil, ErrQueueClosed
+	default:
+	}
+	if data, ok := q.pop(); ok {
+		return data, nil
+	}
+	if ctx == nil {
+		return nil, ErrQueueEmpty
+	}
+	atomic.AddInt32(&q.getWaiters, 1)
+	defer atomic.AddInt32(&q.getWaiters, -1)
+	for {
+		// 登记为等待者后再尝试一次，避免错过登记前发送的信号
+		if data, ok := q.pop(); ok {
+			// 信号可能被合并，唤醒下一个等待者继续尝试
+			q.signal(&q.getWaiters, q.getSignal)
+			return data, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-q.ctx.Done():
+			return nil, ErrQueueClosed
+		case <-q.getSignal:
+		}
+	}
+}
+
+func (q *RingQueue) GetInto(ctx context.Context, dst []byte) ([]byte, error) {
+	data, err := q.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	buf := grow(dst, len(data))
+	copy(buf, data)
+	return buf, nil
+}
+
+func (q *RingQueue) Put(ctx context.Context, data []byte) error {
+	select {
+	case <-q.ctx.Done():
+		return ErrQueueClosed
+	default:
+	}
+	if q.push(data) {
+		return nil
+	}
+	if ctx == nil {
+		return ErrQueueFull
+	}
+	atomic.AddInt32(&q.putWaiters, 1)
+	defer atomic.AddInt32(&q.putWaiters, -1)
+	for {
+		if q.push(data) {
+			q.signal(&q.putWaiters, q.putSignal)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-q.ctx.Done():
+			return ErrQueueClosed
+		case <-q.putSignal:
+		}
+	}
+}
+
+// Len 返回调用时刻的近似长度，并发读写时可能已经过期
+func (q *RingQueue) Len() int {
+	dequeue := atomic.LoadUint64(&q.dequeue)
+	enqueue := atomic.LoadUint64(&q.enqueue)
+	if enqueue <= dequeue {
+		return 0
+	}
+	if length := int(enqueue - dequeue); length < len(q.cells) {
+		return length
+	}
+	return len(q.cells)
+}
+
+// Stats 写入、读取位置即打开以来的 Put/Get 次数
+func (q *RingQueue) Stats() Stats {
+	stats := Stats{
+		Gets:   int64(atomic.LoadUint64(&q.dequeue)),
+		Bytes:  atomic.LoadInt64(&q.bytes),
+		Puts:   int64(atomic.LoadUint64(&q.enqueue)),
+		Closed: q.ctx.Err() != nil,
+	}
+	if stats.Puts > stats.Gets {
+		stats.Len = int(stats.Puts - stats.Gets)
+	}
+	if stats.Bytes < 0 {
+		stats.Bytes = 0
+	}
+	return stats
+}
+
+func (q *RingQueue) Close() error {
+	q.cancel()
+	return nil
+}
+
+func (q *RingQueue) push(data []byte) bool {
+	position := atomic.LoadUint64(&q.enqueue)
+	for {
+		cell := &q.cells[position&q.mask]
+		sequence := atomic.LoadUint64(&cell.sequence)
+		switch diff := int64(sequence - position); {
+		case diff == 0:
+			if !atomic.CompareAndSwapUint64(&q.enqueue, position, position+1) {
+				position = atomic.LoadUint64(&q.enqueue)
+				continue
+			}
+			cell.data = data
+			atomic.AddInt64(&q.bytes, int64(len(data)))
+			atomic.StoreUint64(&cell.sequence, position+1)
+			q.signal(&q.getWaiters, q.getSignal)
+			return true
+		case diff < 0:
+			// 槽位还未被读取，队列已满
+			return false
+		default:
+			position = atomic.LoadUint64(&q.enqueue)
+		}
+	}
+}
+
+func (q *RingQueue) pop() ([]byte, bool) {
+	position := atomic.LoadUint64(&q.dequeue)
+	for {
+		cell := &q.cells[position&q.mask]
+		sequence := atomic.LoadUint64(&cell.sequence)
+		switch diff := int64(sequence - (position + 1)); {
+		case diff == 0:
+			if !atomic.CompareAndSwapUint64(&q.dequeue, position, position+1) {
+				position = atomic.LoadUint64(&q.dequeue)
+				continue
+			}
+			data := cell.data
+			cell.data = nil
+			atomic.AddInt64(&q.bytes, -int64(len(data)))
+			atomic.StoreUint64(&cell.sequence, position+q.mask+1)
+			q.signal(&q.putWaiters, q.putSignal)
+			return data, true
+		case diff < 0:
+			// 槽位还未被写入，队列为空
+			return nil, false
+		default:
+			position = atomic.LoadUint64(&q.dequeue)
+		}
+	}
+}
+
+// 有等待者时发送信号，信号已存在时不重复发送
+func (q *RingQueue) signal(waiters *int32, signal chan struct{}) {
+	if atomic.LoadInt32(waiters) == 0 {
+		return
+	}
+	select {
+	case signal <- struct{}{}:
+	default:
+	}
+}
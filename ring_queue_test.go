@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestNewRingQueue(t *testing.T) {
+	test_queue("TestNewRingQueue", NewRingQueue(1000), t)
+}
+
+func TestRingQueueConcurrent(t *testing.T) {
+	name := "TestRingQueueConcurrent"
+	queue := NewRingQueue(8)
+	counts := make([]int, 8*1000)
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if err := queue.Put(context.Background(), []byte{byte(i), byte(j >> 8), byte(j)}); err != nil {
+					t.Error(name, "并发Put返回nil", err)
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			last := map[byte]int{}
+			for j := 0; j < 1000; j++ {
+				data, err := queue.Get(context.Background())
+				if err != nil {
+					t.Error(name, "并发Get返回nil", err)
+					return
+				}
+				// 同一生产者的数据按序读取
+				n := int(data[1])<<8 | int(data[2])
+				if previous, ok := last[data[0]]; ok && n <= previous {
+					t.Error(name, "同一生产者的数据按序读取", data[0], previous, n)
+				}
+				last[data[0]] = n
+				lock.Lock()
+				counts[int(data[0])*1000+n]++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	for i, count := range counts {
+		if count != 1 {
+			t.Fatal(name, "每条数据只读取一次", i, count)
+		}
+	}
+	if length := queue.Len(); length != 0 {
+		t.Error(name, "读取完毕后长度为0", length)
+	}
+}
+
+func benchmarkMemoryQueue(b *testing.B, queue Queue, producers, consumers int) {
+	data := []byte("data")
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	wg := sync.WaitGroup{}
+	for i := 0; i < producers; i++ {
+		n := b.N / producers
+		if i < b.N%producers {
+			n++
+		}
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				_ = queue.Put(ctx, data)
+			}
+		}(n)
+	}
+	for i := 0; i < consumers; i++ {
+		n := b.N / consumers
+		if i < b.N%consumers {
+			n++
+		}
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				_, _ = queue.Get(ctx)
+			}
+		}(n)
+	}
+	wg.Wait()
+}
+
+func BenchmarkMemoryQueue(b *testing.B) {
+	for _, c := range []struct{ producers, consumers int }{{1, 1}, {4, 4}, {16, 1}, {16, 16}} {
+		for _, q := range []struct {
+			name  string
+			queue func() Queue
+		}{
+			{"FifoMemoryQueue", func() Queue { return NewFifoMemoryQueue(1024) }},
+			{"LifoMemoryQueue", func() Queue { return NewLifoMemoryQueue(1024) }},
+			{"RingQueue", func() Queue { return NewRingQueue(1024) }},
+		} {
+			b.Run(fmt.Sprintf("%s/%dP%dC", q.name, c.producers, c.consumers), func(b *testing.B) {
+				benchmarkMemoryQueue(b, q.queue(), c.producers, c.consumers)
+			})
+		}
+	}
+}
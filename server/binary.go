@@ -0,0 +1,385 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/czasg/go-queue"
+)
+
+// 二进制协议，沿用 FifoDiskQueue 的 int32 大端长度前缀分帧：
+//
+//	请求 [int32 长度][uint32 请求ID][uint8 操作][uint16 队列名长度][队列名][参数]
+//	响应 [int32 长度][uint32 请求ID][uint8 状态][数据]
+//
+// Put 参数为 [int64 超时毫秒][数据]，Get 参数为 [int64 超时毫秒]，Len 无参数，Len 响应数据为 int64。
+// 超时为 0 表示不阻塞，为 -1 表示阻塞直到 Cancel 或连接断开。
+// Cancel 参数为 [uint32 被取消的请求ID]，没有响应。
+// 每个连接同时处理的请求数超过 MaxInflight 时，新请求直接返回错误，请求ID与处理中的请求重复时也返回错误。
+// 请求超过 MaxFrameSize 时关闭连接。
+const (
+	opPut byte = iota + 1
+	opGet
+	opLen
+	opCancel
+)
+
+const (
+	binaryOK byte = iota
+	binaryEmpty
+	binaryFull
+	binaryClosed
+	binaryNotFound
+	binaryError
+	binaryTooLarge
+)
+
+const (
+	// 协议允许的最大帧，客户端读取响应时使用
+	binaryMaxFrameSize        = 512 * 1024 * 1024
+	binaryDefaultMaxFrameSize = 32 << 20
+	binaryDefaultMaxInflight  = 64
+)
+
+var errFrameTooLarge = errors.New("frame too large")
+
+// 读取不超过 maxSize 字节的帧，按实际到达的数据分块读取，不按长度前缀预先分配
+func readFrame(r io.Reader, maxSize int) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := int32(binary.BigEndian.Uint32(header))
+	if length < 0 || int64(length) > int64(maxSize) {
+		return nil, errFrameTooLarge
+	}
+	frame := bytes.Buffer{}
+	if _, err := io.CopyN(&frame, r, int64(length)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return frame.Bytes(), nil
+}
+
+func writeFrame(w io.Writer, parts ...[]byte) error {
+	length := 0
+	for _, part := range parts {
+		length += len(part)
+	}
+	if length > binaryMaxFrameSize {
+		return errFrameTooLarge
+	}
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(length))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NewBinaryServer() *BinaryServer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &BinaryServer{
+		PollInterval: time.Millisecond * 10,
+		MaxInflight:  binaryDefaultMaxInflight,
+		MaxFrameSize: binaryDefaultMaxFrameSize,
+		conns:        map[net.Conn]struct{}{},
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+type BinaryServer struct {
+	// 磁盘队列不支持阻塞获取，阻塞 Get 时的轮询间隔
+	PollInterval time.Duration
+	// 每个连接同时处理的最大请求数，限制阻塞请求及其数据占用的内存
+	MaxInflight int
+	// 单个请求帧的最大字节数，超出时关闭连接，为 0 时使用默认值
+	MaxFrameSize int
+
+	registry
+	lock      sync.Mutex
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+func (s *BinaryServer) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+func (s *BinaryServer) Serve(listener net.Listener) error {
+	s.lock.Lock()
+	if s.ctx.Err() != nil {
+		s.lock.Unlock()
+		listener.Close()
+		return queue.ErrQueueClosed
+	}
+	s.listeners = append(s.listeners, listener)
+	s.lock.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		s.lock.Lock()
+		if s.ctx.Err() != nil {
+			s.lock.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.lock.Unlock()
+		go s.serve(conn)
+	}
+}
+
+// Close 关闭监听、所有连接及队列
+func (s *BinaryServer) Close() error {
+	s.lock.Lock()
+	s.cancel()
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.lock.Unlock()
+	s.wg.Wait()
+	return s.closeQueues()
+}
+
+type binaryConn struct {
+	server  *BinaryServer
+	conn    net.Conn
+	writer  *bufio.Writer
+	write   sync.Mutex
+	lock    sync.Mutex
+	cancels map[uint32]context.CancelFunc
+	ctx     context.Context
+	// 处理中的请求占用的槽位
+	inflight chan struct{}
+}
+
+func (s *BinaryServer) serve(conn net.Conn) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	maxInflight := s.MaxInflight
+	if maxInflight <= 0 {
+		maxInflight = binaryDefaultMaxInflight
+	}
+	maxFrameSize := s.MaxFrameSize
+	if maxFrameSize <= 0 {
+		maxFrameSize = binaryDefaultMaxFrameSize
+	}
+	c := &binaryConn{
+		server:   s,
+		conn:     conn,
+		writer:   bufio.NewWriter(conn),
+		cancels:  map[uint32]context.CancelFunc{},
+		ctx:      ctx,
+		inflight: make(chan struct{}, maxInflight),
+	}
+	requests := sync.WaitGroup{}
+	defer func() {
+		cancel()
+		requests.Wait()
+		s.lock.Lock()
+		delete(s.conns, conn)
+		s.lock.Unlock()
+		conn.Close()
+		s.wg.Done()
+	}()
+	reader := bufio.NewReader(conn)
+	for {
+		frame, err := readFrame(reader, maxFrameSize)
+		if err != nil || len(frame) < 5 {
+			return
+		}
+		id, op := binary.BigEndian.Uint32(frame), frame[4]
+		if op == opCancel {
+			if len(frame) >= 9 {
+				c.cancel(binary.BigEndian.Uint32(frame[5:]))
+			}
+			continue
+		}
+		select {
+		case c.inflight <- struct{}{}:
+		default:
+			// 不等待槽位，否则无法继续读取 Cancel
+			c.reply(id, binaryError, []byte("too many in-flight requests"))
+			continue
+		}
+		// 启动 goroutine 前登记，保证之后读取到的 Cancel 能找到该请求
+		reqCtx, done, ok := c.register(id)
+		if !ok {
+			<-c.inflight
+			c.reply(id, binaryError, []byte("request id in flight"))
+			continue
+		}
+		requests.Add(1)
+		go func() {
+			defer requests.Done()
+			defer func() { <-c.inflight }()
+			defer done()
+			c.handle(reqCtx, id, op, frame[5:])
+		}()
+	}
+}
+
+// ctx 为请求的 ctx，被 Cancel、连接断开或服务关闭时取消
+func (c *binaryConn) handle(ctx context.Context, id uint32, op byte, body []byte) {
+	if len(body) < 2 || len(body) < 2+int(binary.BigEndian.Uint16(body)) {
+		c.reply(id, binaryError, []byte("malformed request"))
+		return
+	}
+	nameLength := int(binary.BigEndian.Uint16(body))
+	name, body := string(body[2:2+nameLength]), body[2+nameLength:]
+	q, ok := c.server.Queue(name)
+	if !ok {
+		c.reply(id, binaryNotFound, nil)
+		return
+	}
+	switch op {
+	case opLen:
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(q.Len()))
+		c.reply(id, binaryOK, buf)
+		return
+	case opPut, opGet:
+	default:
+		c.reply(id, binaryError, []byte(fmt.Sprintf("unknown op %d", op)))
+		return
+	}
+	if len(body) < 8 {
+		c.reply(id, binaryError, []byte("malformed request"))
+		return
+	}
+	if ctx.Err() != nil {
+		// 开始处理前已被取消，客户端不再等待响应，不能再取出数据
+		return
+	}
+	ctx, done := c.context(ctx, int64(binary.BigEndian.Uint64(body)))
+	defer done()
+	var data []byte
+	var err error
+	if op == opPut {
+		err = q.Put(ctx, body[8:])
+	} else if ctx == nil {
+		data, err = q.Get(nil)
+	} else {
+		data, err = queue.GetWait(ctx, q, c.server.PollInterval)
+	}
+	if err != nil && ctx != nil && ctx.Err() != nil {
+		if c.ctx.Err() != nil {
+			// 连接断开或服务关闭，不再响应
+			return
+		}
+		err = queue.ErrQueueEmpty
+		if op == opPut {
+			err = queue.ErrQueueFull
+		}
+	}
+	if op == opPut {
+		c.replyError(id, err)
+		return
+	}
+	if err == nil && c.reply(id, binaryOK, data) != nil {
+		// 连接已断开，数据尽量放回队列
+		_ = q.Put(nil, data)
+		return
+	}
+	if err != nil {
+		c.replyError(id, err)
+	}
+}
+
+// 登记请求的 cancel，返回的 done 在请求处理完毕后调用，id 与处理中的请求重复时 ok 为 false
+func (c *binaryConn) register(id uint32) (ctx context.Context, done func(), ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, exists := c.cancels[id]; exists {
+		return nil, nil, false
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.cancels[id] = cancel
+	return ctx, func() {
+		c.lock.Lock()
+		delete(c.cancels, id)
+		c.lock.Unlock()
+		cancel()
+	}, true
+}
+
+// 根据超时毫秒数生成 ctx，为 nil 表示不阻塞
+func (c *binaryConn) context(ctx context.Context, timeout int64) (context.Context, func()) {
+	if timeout == 0 {
+		return nil, func() {}
+	}
+	if timeout > 0 {
+		return context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+	}
+	return ctx, func() {}
+}
+
+func (c *binaryConn) cancel(id uint32) {
+	c.lock.Lock()
+	cancel, ok := c.cancels[id]
+	c.lock.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+func (c *binaryConn) replyError(id uint32, err error) {
+	switch {
+	case err == nil:
+		c.reply(id, binaryOK, nil)
+	case errors.Is(err, queue.ErrQueueEmpty):
+		c.reply(id, binaryEmpty, nil)
+	case errors.Is(err, queue.ErrQueueFull):
+		c.reply(id, binaryFull, nil)
+	case errors.Is(err, queue.ErrQueueClosed):
+		c.reply(id, binaryClosed, nil)
+	case errors.Is(err, queue.ErrMessageTooLarge):
+		c.reply(id, binaryTooLarge, []byte(err.Error()))
+	default:
+		c.reply(id, binaryError, []byte(err.Error()))
+	}
+}
+
+func (c *binaryConn) reply(id uint32, status byte, data []byte) error {
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header, id)
+	header[4] = status
+	c.write.Lock()
+	defer c.write.Unlock()
+	if err := writeFrame(c.writer, header, data); err != nil {
+		return err
+	}
+	return c.writer.Flush()
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/czasg/go-queue"
+)
+
+type binaryResponse struct {
+	status byte
+	data   []byte
+	err    error
+}
+
+type binaryCall struct {
+	op        byte
+	name      string
+	done      chan binaryResponse
+	abandoned bool
+}
+
+// DialBinary 连接二进制协议服务，多个 goroutine 复用同一连接，请求可流水线发送
+func DialBinary(addr string) (*BinaryClient, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, &NetworkError{Op: "dial", Err: err}
+	}
+	return NewBinaryClient(conn), nil
+}
+
+func NewBinaryClient(conn net.Conn) *BinaryClient {
+	c := &BinaryClient{
+		conn:    conn,
+		writer:  bufio.NewWriter(conn),
+		pending: map[uint32]*binaryCall{},
+	}
+	go c.read()
+	return c
+}
+
+type BinaryClient struct {
+	conn    net.Conn
+	writer  *bufio.Writer
+	write   sync.Mutex
+	lock    sync.Mutex
+	pending map[uint32]*binaryCall
+	id      uint32
+	err     error
+}
+
+// Queue 返回指定名称的远程队列，Close 只关闭该队列句柄
+func (c *BinaryClient) Queue(name string) queue.Queue {
+	return &binaryQueue{client: c, name: name}
+}
+
+func (c *BinaryClient) Close() error {
+	err := c.conn.Close()
+	c.fail(queue.ErrQueueClosed)
+	return err
+}
+
+func (c *BinaryClient) read() {
+	reader := bufio.NewReader(c.conn)
+	for {
+		frame, err := readFrame(reader, binaryMaxFrameSize)
+		if err == nil && len(frame) < 5 {
+			err = errors.New("malformed response")
+		}
+		if err != nil {
+			c.fail(&NetworkError{Op: "read", Err: err})
+			return
+		}
+		id := binary.BigEndian.Uint32(frame)
+		c.lock.Lock()
+		call, ok := c.pending[id]
+		delete(c.pending, id)
+		c.lock.Unlock()
+		if !ok {
+			continue
+		}
+		if call.abandoned {
+			// 调用方已放弃等待，取到的数据放回队列
+			if call.op == opGet && frame[4] == binaryOK {
+				go c.Queue(call.name).Put(nil, frame[5:])
+			}
+			continue
+		}
+		call.done <- binaryResponse{status: frame[4], data: frame[5:]}
+	}
+}
+
+// 连接异常，所有等待中的请求返回 err
+func (c *BinaryClient) fail(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+	for id, call := range c.pending {
+		delete(c.pending, id)
+		if !call.abandoned {
+			call.done <- binaryResponse{err: c.err}
+		}
+	}
+}
+
+func (c *BinaryClient) call(ctx context.Context, op byte, name string, data []byte) binaryResponse {
+	timeout := int64(0)
+	if ctx != nil {
+		timeout = -1
+		if deadline, ok := ctx.Deadline(); ok {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return binaryResponse{err: context.DeadlineExceeded}
+			}
+			// 向上取整，保证客户端的 ctx 先于服务端超时
+			timeout = int64((remaining + time.Millisecond - 1) / time.Millisecond)
+		}
+	}
+	call := &binaryCall{op: op, name: name, done: make(chan binaryResponse, 1)}
+	c.lock.Lock()
+	if c.err != nil {
+		c.lock.Unlock()
+		return binaryResponse{err: c.err}
+	}
+	c.id++
+	id := c.id
+	c.pending[id] = call
+	c.lock.Unlock()
+
+	header := make([]byte, 7+len(name))
+	binary.BigEndian.PutUint32(header, id)
+	header[4] = op
+	binary.BigEndian.PutUint16(header[5:], uint16(len(name)))
+	copy(header[7:], name)
+	parts := [][]byte{header}
+	if op != opLen {
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(timeout))
+		parts = append(parts, buf, data)
+	}
+	if err := c.send(parts...); err != nil {
+		c.lock.Lock()
+		delete(c.pending, id)
+		c.lock.Unlock()
+		return binaryResponse{err: &NetworkError{Op: "write", Err: err}}
+	}
+	if ctx == nil {
+		return <-call.done
+	}
+	select {
+	case resp := <-call.done:
+		return resp
+	case <-ctx.Done():
+	}
+	c.lock.Lock()
+	if _, ok := c.pending[id]; !ok {
+		c.lock.Unlock()
+		return <-call.done
+	}
+	call.abandoned = true
+	c.lock.Unlock()
+	buf := make([]byte, 9)
+	buf[4] = opCancel
+	binary.BigEndian.PutUint32(buf[5:], id)
+	_ = c.send(buf)
+	return binaryResponse{err: ctx.Err()}
+}
+
+func (c *BinaryClient) send(parts ...[]byte) error {
+	c.write.Lock()
+	defer c.write.Unlock()
+	if err := writeFrame(c.writer, parts...); err != nil {
+		return err
+	}
+	return c.writer.Flush()
+}
+
+var _ queue.Queue = (*binaryQueue)(nil)
+
+type binaryQueue struct {
+	client *BinaryClient
+	name   string
+	lock   sync.RWMutex
+	closed bool
+}
+
+func (q *binaryQueue) Get(ctx context.Context) ([]byte, error) {
+	if q.isClosed() {
+		return nil, queue.ErrQueueClosed
+	}
+	resp := q.client.call(ctx, opGet, q.name, nil)
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	if resp.status == binaryEmpty && ctx != nil {
+		if err := timeoutError(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if resp.status != binaryOK {
+		return nil, binaryStatusError(resp)
+	}
+	return resp.data, nil
+}
+
+func (q *binaryQueue) Put(ctx context.Context, data []byte) error {
+	if q.isClosed() {
+		return queue.ErrQueueClosed
+	}
+	resp := q.client.call(ctx, opPut, q.name, data)
+	if resp.err != nil {
+		return resp.err
+	}
+	if resp.status == binaryFull && ctx != nil {
+		if err := timeoutError(ctx); err != nil {
+			return err
+		}
+	}
+	if resp.status != binaryOK {
+		return binaryStatusError(resp)
+	}
+	return nil
+}
+
+// Len 查询服务端队列长度，请求失败时返回 -1
+func (q *binaryQueue) Len() int {
+	if q.isClosed() {
+		return -1
+	}
+	resp := q.client.call(nil, opLen, q.name, nil)
+	if resp.err != nil || resp.status != binaryOK || len(resp.data) != 8 {
+		return -1
+	}
+	return int(binary.BigEndian.Uint64(resp.data))
+}
+
+func (q *binaryQueue) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.closed = true
+	return nil
+}
+
+func (q *binaryQueue) isClosed() bool {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	return q.closed
+}
+
+func binaryStatusError(resp binaryResponse) error {
+	switch resp.status {
+	case binaryEmpty:
+		return queue.ErrQueueEmpty
+	case binaryFull:
+		return queue.ErrQueueFull
+	case binaryClosed:
+		return queue.ErrQueueClosed
+	case binaryNotFound:
+		return ErrQueueNotFound
+	case binaryTooLarge:
+		return queue.ErrMessageTooLarge
+	}
+	return errors.New(string(resp.data))
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/czasg/go-queue"
+)
+
+func startBinaryServer() (*BinaryServer, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	s := NewBinaryServer()
+	s.PollInterval = time.Millisecond
+	go s.Serve(listener)
+	return s, listener.Addr().String()
+}
+
+func TestBinaryServer(t *testing.T) {
+	name := "TestBinaryServer"
+	s, addr := startBinaryServer()
+	defer s.Close()
+	_ = s.Register("fifo", queue.NewFifoMemoryQueueWithOptions(1, queue.WithMemoryMaxMessageSize(8)))
+	client, err := DialBinary(addr)
+	if err != nil {
+		panic(err)
+	}
+	defer client.Close()
+	q := client.Queue("fifo")
+	if length := q.Len(); length != 0 {
+		t.Error(name, "空队列-获取长度为0", length)
+	}
+	if data, err := q.Get(nil); data != nil || !errors.Is(err, queue.ErrQueueEmpty) {
+		t.Error(name, "空队列-Get数据返回ErrQueueEmpty", data, err)
+	}
+	if err := q.Put(nil, []byte("data")); err != nil {
+		t.Error(name, "Put数据返回nil", err)
+	}
+	if err := q.Put(nil, []byte("data")); !errors.Is(err, queue.ErrQueueFull) {
+		t.Error(name, "满队列Put返回ErrQueueFull", err)
+	}
+	if err := q.Put(nil, []byte("too large")); !errors.Is(err, queue.ErrMessageTooLarge) {
+		t.Error(name, "超出最大长度Put返回ErrMessageTooLarge", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	if err := q.Put(ctx, []byte("data")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error(name, "阻塞Put超时返回DeadlineExceeded", err)
+	}
+	cancel()
+	if data, err := q.Get(nil); string(data) != "data" || err != nil {
+		t.Error(name, "Get数据", data, err)
+	}
+	if _, err := client.Queue("unknown").Get(nil); !errors.Is(err, ErrQueueNotFound) {
+		t.Error(name, "队列不存在返回ErrQueueNotFound", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 20)
+		cancel()
+	}()
+	if data, err := q.Get(ctx); data != nil || !errors.Is(err, context.Canceled) {
+		t.Error(name, "ctx取消-阻塞Get返回Canceled", data, err)
+	}
+
+	// 多个 goroutine 复用同一连接，阻塞 Get 不影响其他请求
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if data, err := q.Get(context.Background()); string(data) != "block" || err != nil {
+				t.Error(name, "并发阻塞Get数据", data, err)
+			}
+		}()
+	}
+	time.Sleep(time.Millisecond * 20)
+	for i := 0; i < 10; i++ {
+		if err := q.Put(context.Background(), []byte("block")); err != nil {
+			t.Error(name, "并发阻塞Put数据", err)
+		}
+	}
+	wg.Wait()
+
+	_ = q.Close()
+	if err := q.Put(nil, []byte("data")); !errors.Is(err, queue.ErrQueueClosed) {
+		t.Error(name, "队列句柄关闭返回ErrQueueClosed", err)
+	}
+}
+
+func TestBinaryClientNetworkError(t *testing.T) {
+	name := "TestBinaryClientNetworkError"
+	s, addr := startBinaryServer()
+	_ = s.Register("fifo", queue.NewLifoMemoryQueue())
+	client, err := DialBinary(addr)
+	if err != nil {
+		panic(err)
+	}
+	q := client.Queue("fifo")
+	done := make(chan error)
+	go func() {
+		_, err := q.Get(context.Background())
+		done <- err
+	}()
+	time.Sleep(time.Millisecond * 20)
+	_ = s.Close()
+	var netErr *NetworkError
+	if err := <-done; !errors.As(err, &netErr) {
+		t.Error(name, "服务关闭返回NetworkError", err)
+	}
+	if length := q.Len(); length != -1 {
+		t.Error(name, "连接断开获取长度返回-1", length)
+	}
+}
+
+// 按协议格式构造请求帧，timeout 为 nil 时没有超时参数
+func binaryRequest(id uint32, op byte, name string, timeout *int64) []byte {
+	buf := make([]byte, 7+len(name))
+	binary.BigEndian.PutUint32(buf, id)
+	buf[4] = op
+	binary.BigEndian.PutUint16(buf[5:], uint16(len(name)))
+	copy(buf[7:], name)
+	if timeout != nil {
+		buf = append(buf, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(buf[7+len(name):], uint64(*timeout))
+	}
+	return buf
+}
+
+func binaryCancel(id uint32) []byte {
+	buf := make([]byte, 9)
+	buf[4] = opCancel
+	binary.BigEndian.PutUint32(buf[5:], id)
+	return buf
+}
+
+func TestBinaryServerCancel(t *testing.T) {
+	name := "TestBinaryServerCancel"
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	s := NewBinaryServer()
+	s.MaxInflight = 1
+	go s.Serve(listener)
+	defer s.Close()
+	q := queue.NewFifoMemoryQueue()
+	_ = s.Register("fifo", q)
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+	block := int64(-1)
+	// Get 与 Cancel 在同一次写入中到达，Cancel 不能丢失
+	buf := bytes.Buffer{}
+	_ = writeFrame(&buf, binaryRequest(1, opGet, "fifo", &block))
+	_ = writeFrame(&buf, binaryCancel(1))
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		panic(err)
+	}
+	time.Sleep(time.Millisecond * 20)
+	_ = q.Put(nil, []byte("data"))
+	time.Sleep(time.Millisecond * 20)
+	if length := q.Len(); length != 1 {
+		t.Error(name, "已取消的Get不取出数据", length)
+	}
+
+	// 超出 MaxInflight 的请求直接返回错误，Cancel 仍然可以处理
+	_, _ = q.Get(nil)
+	_ = writeFrame(conn, binaryRequest(2, opGet, "fifo", &block))
+	time.Sleep(time.Millisecond * 20)
+	_ = writeFrame(conn, binaryRequest(3, opLen, "fifo", nil))
+	frame, err := readFrame(conn, binaryMaxFrameSize)
+	if err != nil || binary.BigEndian.Uint32(frame) != 3 || frame[4] != binaryError {
+		t.Error(name, "超出MaxInflight返回错误", frame, err)
+	}
+	_ = writeFrame(conn, binaryCancel(2))
+	frame, err = readFrame(conn, binaryMaxFrameSize)
+	if err != nil || binary.BigEndian.Uint32(frame) != 2 || frame[4] != binaryEmpty {
+		t.Error(name, "取消阻塞的Get", frame, err)
+	}
+	_ = writeFrame(conn, binaryRequest(4, opLen, "fifo", nil))
+	frame, err = readFrame(conn, binaryMaxFrameSize)
+	if err != nil || binary.BigEndian.Uint32(frame) != 4 || frame[4] != binaryOK {
+		t.Error(name, "请求完成后释放槽位", frame, err)
+	}
+}
+
+func TestBinaryServerLimits(t *testing.T) {
+	name := "TestBinaryServerLimits"
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	s := NewBinaryServer()
+	s.MaxFrameSize = 64
+	go s.Serve(listener)
+	defer s.Close()
+	_ = s.Register("fifo", queue.NewFifoMemoryQueue())
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+	block := int64(-1)
+	_ = writeFrame(conn, binaryRequest(1, opGet, "fifo", &block))
+	time.Sleep(time.Millisecond * 20)
+	// 请求ID与处理中的请求重复时返回错误，原请求不受影响
+	_ = writeFrame(conn, binaryRequest(1, opLen, "fifo", nil))
+	frame, err := readFrame(conn, binaryMaxFrameSize)
+	if err != nil || binary.BigEndian.Uint32(frame) != 1 || frame[4] != binaryError {
+		t.Error(name, "重复的请求ID返回错误", frame, err)
+	}
+	_ = writeFrame(conn, binaryCancel(1))
+	frame, err = readFrame(conn, binaryMaxFrameSize)
+	if err != nil || binary.BigEndian.Uint32(frame) != 1 || frame[4] != binaryEmpty {
+		t.Error(name, "取消原请求", frame, err)
+	}
+	// 超出 MaxFrameSize 的请求关闭连接
+	_ = writeFrame(conn, binaryRequest(2, opPut, "fifo", &block), make([]byte, 64))
+	if frame, err = readFrame(conn, binaryMaxFrameSize); err == nil {
+		t.Error(name, "请求超出MaxFrameSize关闭连接", frame)
+	}
+}
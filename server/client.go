@@ -0,0 +1,194 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/czasg/go-queue"
+)
+
+// NetworkError 网络异常，与队列本身的 ErrQueueEmpty 等错误区分
+type NetworkError struct {
+	Op  string
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return "queue " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// NewClient 创建远程队列客户端，addr 为 Server 地址，如 http://127.0.0.1:8080
+func NewClient(addr, name string, clients ...*http.Client) queue.Queue {
+	client := http.DefaultClient
+	if len(clients) > 0 {
+		client = clients[0]
+	}
+	return &Client{
+		url:    strings.TrimSuffix(addr, "/") + "/queues/" + url.PathEscape(name),
+		client: client,
+	}
+}
+
+var _ queue.Queue = (*Client)(nil)
+
+type Client struct {
+	url    string
+	client *http.Client
+	lock   sync.RWMutex
+	closed bool
+}
+
+// Get ctx 为 nil 时不阻塞，ctx 的超时时间作为服务端长轮询的超时时间
+func (c *Client) Get(ctx context.Context) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, c.networkError(ctx, "get", err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return body, nil
+	}
+	if resp.StatusCode == StatusQueueEmpty && ctx != nil {
+		if err := timeoutError(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return nil, statusError(resp.StatusCode, body)
+}
+
+func (c *Client) Put(ctx context.Context, data []byte) error {
+	resp, err := c.do(ctx, http.MethodPut, "", data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return c.networkError(ctx, "put", err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	if resp.StatusCode == StatusQueueFull && ctx != nil {
+		if err := timeoutError(ctx); err != nil {
+			return err
+		}
+	}
+	return statusError(resp.StatusCode, body)
+}
+
+// Len 查询服务端队列长度，请求失败时返回 -1
+func (c *Client) Len() int {
+	resp, err := c.do(nil, http.MethodGet, "/len", nil)
+	if err != nil {
+		return -1
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return -1
+	}
+	length, err := strconv.Atoi(string(body))
+	if err != nil {
+		return -1
+	}
+	return length
+}
+
+// Close 只关闭客户端，不关闭服务端队列
+func (c *Client) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, data []byte) (*http.Response, error) {
+	c.lock.RLock()
+	closed := c.closed
+	c.lock.RUnlock()
+	if closed {
+		return nil, queue.ErrQueueClosed
+	}
+	target := c.url + path
+	reqCtx := ctx
+	if ctx == nil {
+		reqCtx = context.Background()
+	} else if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+		target += "?timeout=" + serverTimeout(timeout).String()
+	} else {
+		target += "?timeout=-1"
+	}
+	req, err := http.NewRequestWithContext(reqCtx, method, target, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, c.networkError(ctx, strings.ToLower(method), err)
+	}
+	return resp, nil
+}
+
+// 服务端超时比本地 ctx 提前的时间，保证服务端先返回，不会在请求中断时取出数据
+const serverTimeoutMargin = time.Millisecond * 50
+
+// 发送给服务端的超时，比本地剩余时间短 serverTimeoutMargin，剩余时间较短时取一半
+func serverTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 2*serverTimeoutMargin {
+		return timeout / 2
+	}
+	return timeout - serverTimeoutMargin
+}
+
+// ctx 失效导致的请求中断返回 ctx.Err()，与本地队列保持一致
+func (c *Client) networkError(ctx context.Context, op string, err error) error {
+	if ctx != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return &NetworkError{Op: op, Err: err}
+}
+
+// 阻塞请求因服务端超时返回时，等待本地 ctx 到期并返回 ctx.Err()，与本地队列保持一致
+func timeoutError(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); ok {
+		<-ctx.Done()
+	}
+	return ctx.Err()
+}
+
+func statusError(code int, body []byte) error {
+	switch code {
+	case StatusQueueEmpty:
+		return queue.ErrQueueEmpty
+	case StatusQueueFull:
+		return queue.ErrQueueFull
+	case StatusQueueClosed:
+		return queue.ErrQueueClosed
+	case StatusTooLarge:
+		return queue.ErrMessageTooLarge
+	case http.StatusNotFound:
+		return ErrQueueNotFound
+	}
+	return fmt.Errorf("unexpected status %d: %s", code, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/czasg/go-queue"
+)
+
+func TestClient(t *testing.T) {
+	name := "TestClient"
+	s := NewServer()
+	_ = s.Register("fifo", queue.NewFifoMemoryQueueWithOptions(1, queue.WithMemoryMaxMessageSize(8)))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	defer s.Close()
+
+	q := NewClient(ts.URL, "fifo")
+	if length := q.Len(); length != 0 {
+		t.Error(name, "空队列-获取长度为0", length)
+	}
+	if data, err := q.Get(nil); data != nil || !errors.Is(err, queue.ErrQueueEmpty) {
+		t.Error(name, "空队列-Get数据返回ErrQueueEmpty", data, err)
+	}
+	if err := q.Put(nil, []byte("data")); err != nil {
+		t.Error(name, "Put数据返回nil", err)
+	}
+	if err := q.Put(nil, []byte("data")); !errors.Is(err, queue.ErrQueueFull) {
+		t.Error(name, "满队列Put返回ErrQueueFull", err)
+	}
+	if err := q.Put(nil, []byte("too large")); !errors.Is(err, queue.ErrMessageTooLarge) {
+		t.Error(name, "超出最大长度Put返回ErrMessageTooLarge", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	if err := q.Put(ctx, []byte("data")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error(name, "阻塞Put超时返回DeadlineExceeded", err)
+	}
+	cancel()
+	if length := q.Len(); length != 1 {
+		t.Error(name, "获取长度为1", length)
+	}
+	if data, err := q.Get(nil); string(data) != "data" || err != nil {
+		t.Error(name, "Get数据", data, err)
+	}
+	go func() {
+		time.Sleep(time.Millisecond * 20)
+		_ = q.Put(nil, []byte("block"))
+	}()
+	if data, err := q.Get(context.Background()); string(data) != "block" || err != nil {
+		t.Error(name, "阻塞Get数据", data, err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 20)
+		cancel()
+	}()
+	if data, err := q.Get(ctx); data != nil || !errors.Is(err, context.Canceled) {
+		t.Error(name, "ctx取消-阻塞Get返回Canceled", data, err)
+	}
+
+	if _, err := NewClient(ts.URL, "unknown").Get(nil); !errors.Is(err, ErrQueueNotFound) {
+		t.Error(name, "队列不存在返回ErrQueueNotFound", err)
+	}
+	_ = q.Close()
+	if err := q.Put(nil, []byte("data")); !errors.Is(err, queue.ErrQueueClosed) {
+		t.Error(name, "客户端关闭返回ErrQueueClosed", err)
+	}
+}
+
+func TestClientNetworkError(t *testing.T) {
+	name := "TestClientNetworkError"
+	ts := httptest.NewServer(NewServer())
+	ts.Close()
+	q := NewClient(ts.URL, "fifo")
+	_, err := q.Get(nil)
+	var netErr *NetworkError
+	if !errors.As(err, &netErr) || errors.Is(err, queue.ErrQueueEmpty) {
+		t.Error(name, "网络异常返回NetworkError", err)
+	}
+	if length := q.Len(); length != -1 {
+		t.Error(name, "网络异常获取长度返回-1", length)
+	}
+}
+
+func TestClientServerTimeout(t *testing.T) {
+	name := "TestClientServerTimeout"
+	s := NewServer()
+	_ = s.Register("fifo", queue.NewFifoMemoryQueue())
+	defer s.Close()
+	timeouts := make(chan time.Duration, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout, _ := time.ParseDuration(r.URL.Query().Get("timeout"))
+		timeouts <- timeout
+		s.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	q := NewClient(ts.URL, "fifo")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	if data, err := q.Get(ctx); data != nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Error(name, "阻塞Get超时返回DeadlineExceeded", data, err)
+	}
+	if timeout := <-timeouts; timeout <= 0 || timeout > time.Millisecond*150 {
+		t.Error(name, "服务端超时短于本地超时", timeout)
+	}
+}
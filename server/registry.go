@@ -0,0 +1,59 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/czasg/go-queue"
+)
+
+// 按名称管理托管的队列，HTTP 与二进制协议服务共用
+type registry struct {
+	lock   sync.RWMutex
+	queues map[string]queue.Queue
+}
+
+func (r *registry) Register(name string, q queue.Queue) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.queues == nil {
+		r.queues = map[string]queue.Queue{}
+	}
+	if _, ok := r.queues[name]; ok {
+		return ErrQueueExists
+	}
+	r.queues[name] = q
+	return nil
+}
+
+func (r *registry) Queue(name string) (queue.Queue, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	q, ok := r.queues[name]
+	return q, ok
+}
+
+// 移除并关闭队列
+func (r *registry) remove(name string) error {
+	r.lock.Lock()
+	q, ok := r.queues[name]
+	delete(r.queues, name)
+	r.lock.Unlock()
+	if !ok {
+		return ErrQueueNotFound
+	}
+	return q.Close()
+}
+
+// 关闭所有队列
+func (r *registry) closeQueues() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var first error
+	for name, q := range r.queues {
+		if err := q.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(r.queues, name)
+	}
+	return first
+}
@@ -0,0 +1,469 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/czasg/go-queue"
+)
+
+const (
+	// 默认的单个参数最大字节数
+	respDefaultMaxBulkSize = 32 << 20
+	// 行内命令及参数长度等行的最大字节数
+	respMaxLineSize = 64 * 1024
+)
+
+var errRESPProtocol = errors.New("ERR protocol error")
+
+// NewRESPServer 创建兼容 Redis 协议的队列服务，支持 LPUSH/RPUSH/LPOP/RPOP/BLPOP/BRPOP/LLEN。
+// 每个 list 对应一个队列，由 newQueue 按名称创建，为 nil 时使用 FifoMemoryQueue。
+// 队列只有一个写入端和一个读取端，LPUSH/RPUSH 都是 Put，LPOP/RPOP 都是 Get。
+// 每个 list 第一次 PUSH 或 POP 时确定方向，之后与队列顺序不符的命令返回错误：
+// LifoMemoryQueue、LifoDiskQueue 只能在同一端 PUSH/POP，其他队列按 FIFO 处理，只能在两端分别 PUSH/POP。
+// 方向只在内存中记录，服务重启后由第一条命令重新确定。
+func NewRESPServer(newQueue func(name string) (queue.Queue, error)) *RESPServer {
+	if newQueue == nil {
+		newQueue = func(name string) (queue.Queue, error) {
+			return queue.NewFifoMemoryQueue(), nil
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RESPServer{
+		PollInterval: time.Millisecond * 10,
+		MaxBulkSize:  respDefaultMaxBulkSize,
+		newQueue:     newQueue,
+		queues:       map[string]queue.Queue{},
+		sides:        map[string]byte{},
+		conns:        map[net.Conn]struct{}{},
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+type RESPServer struct {
+	// 磁盘队列、多个 key 的 BLPOP/BRPOP 按此间隔轮询
+	PollInterval time.Duration
+	// 单个参数的最大字节数，超出时返回协议错误并断开连接，为 0 时使用默认值
+	MaxBulkSize int
+
+	newQueue func(name string) (queue.Queue, error)
+	lock     sync.Mutex
+	queues   map[string]queue.Queue
+	// list 的 PUSH 端，'L' 或 'R'
+	sides     map[string]byte
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+func (s *RESPServer) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+func (s *RESPServer) Serve(listener net.Listener) error {
+	s.lock.Lock()
+	if s.ctx.Err() != nil {
+		s.lock.Unlock()
+		listener.Close()
+		return queue.ErrQueueClosed
+	}
+	s.listeners = append(s.listeners, listener)
+	s.lock.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		s.lock.Lock()
+		if s.ctx.Err() != nil {
+			s.lock.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.lock.Unlock()
+		go s.serve(conn)
+	}
+}
+
+// Close 关闭监听、所有连接及队列
+func (s *RESPServer) Close() error {
+	s.lock.Lock()
+	s.cancel()
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.lock.Unlock()
+	s.wg.Wait()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var first error
+	for name, q := range s.queues {
+		if err := q.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(s.queues, name)
+	}
+	return first
+}
+
+func (s *RESPServer) serve(conn net.Conn) {
+	defer func() {
+		s.lock.Lock()
+		delete(s.conns, conn)
+		s.lock.Unlock()
+		conn.Close()
+		s.wg.Done()
+	}()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	for {
+		args, err := readCommand(reader, s.maxBulkSize())
+		if err != nil {
+			if errors.Is(err, errRESPProtocol) {
+				writeRESPError(writer, err)
+				writer.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := s.execute(conn, reader, writer, args)
+		if err := writer.Flush(); err != nil || quit {
+			return
+		}
+	}
+}
+
+func (s *RESPServer) maxBulkSize() int {
+	if s.MaxBulkSize <= 0 {
+		return respDefaultMaxBulkSize
+	}
+	return s.MaxBulkSize
+}
+
+func (s *RESPServer) execute(conn net.Conn, r *bufio.Reader, w *bufio.Writer, args []string) (quit bool) {
+	command := strings.ToUpper(args[0])
+	args = args[1:]
+	switch command {
+	case "PING":
+		if len(args) > 0 {
+			writeBulk(w, []byte(args[0]))
+		} else {
+			w.WriteString("+PONG\r\n")
+		}
+	case "QUIT":
+		w.WriteString("+OK\r\n")
+		return true
+	case "SELECT":
+		w.WriteString("+OK\r\n")
+	case "COMMAND":
+		w.WriteString("*0\r\n")
+	case "LPUSH", "RPUSH":
+		if len(args) < 2 {
+			writeArgsError(w, command)
+			return
+		}
+		q, err := s.queue(args[0], true)
+		if err == nil {
+			err = s.checkSide(args[0], q, true, command[0])
+		}
+		if err == nil {
+			for _, value := range args[1:] {
+				if err = q.Put(nil, []byte(value)); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			writeRESPError(w, err)
+			return
+		}
+		fmt.Fprintf(w, ":%d\r\n", q.Len())
+	case "LPOP", "RPOP":
+		if len(args) != 1 {
+			writeArgsError(w, command)
+			return
+		}
+		q, err := s.queue(args[0], false)
+		if err != nil {
+			writeRESPError(w, err)
+			return
+		}
+		if q == nil {
+			w.WriteString("$-1\r\n")
+			return
+		}
+		if err := s.checkSide(args[0], q, false, command[0]); err != nil {
+			writeRESPError(w, err)
+			return
+		}
+		data, err := q.Get(nil)
+		if errors.Is(err, queue.ErrQueueEmpty) {
+			w.WriteString("$-1\r\n")
+			return
+		}
+		if err != nil {
+			writeRESPError(w, err)
+			return
+		}
+		writeBulk(w, data)
+		if err := w.Flush(); err != nil {
+			// 连接已断开，数据尽量放回队列
+			_ = q.Put(nil, data)
+		}
+	case "BLPOP", "BRPOP":
+		if len(args) < 2 {
+			writeArgsError(w, command)
+			return
+		}
+		s.blockingPop(conn, r, w, command[1], args[:len(args)-1], args[len(args)-1])
+	case "LLEN":
+		if len(args) != 1 {
+			writeArgsError(w, command)
+			return
+		}
+		q, err := s.queue(args[0], false)
+		if err != nil {
+			writeRESPError(w, err)
+			return
+		}
+		length := 0
+		if q != nil {
+			length = q.Len()
+		}
+		fmt.Fprintf(w, ":%d\r\n", length)
+	default:
+		fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", strings.ToLower(command))
+	}
+	return
+}
+
+// timeout 单位为秒，0 表示一直阻塞，连接断开时停止阻塞
+func (s *RESPServer) blockingPop(conn net.Conn, r *bufio.Reader, w *bufio.Writer, side byte, keys []string, timeout string) {
+	seconds, err := strconv.ParseFloat(timeout, 64)
+	if err != nil || seconds < 0 {
+		w.WriteString("-ERR timeout is not a float or out of range\r\n")
+		return
+	}
+	ctx, cancel := s.ctx, context.CancelFunc(func() {})
+	if seconds > 0 {
+		ctx, cancel = context.WithTimeout(s.ctx, time.Duration(seconds*float64(time.Second)))
+	}
+	defer cancel()
+	ctx, stop := watchConn(ctx, conn, r)
+	defer stop()
+	queues := make([]queue.Queue, len(keys))
+	for i, key := range keys {
+		if queues[i], err = s.queue(key, true); err == nil {
+			err = s.checkSide(key, queues[i], false, side)
+		}
+		if err != nil {
+			writeRESPError(w, err)
+			return
+		}
+	}
+	for {
+		for i, q := range queues {
+			var data []byte
+			if len(queues) == 1 {
+				data, err = queue.GetWait(ctx, q, s.PollInterval)
+			} else {
+				data, err = q.Get(nil)
+			}
+			if err == nil {
+				w.WriteString("*2\r\n")
+				writeBulk(w, []byte(keys[i]))
+				writeBulk(w, data)
+				if err := w.Flush(); err != nil {
+					// 连接已断开，数据尽量放回队列
+					_ = q.Put(nil, data)
+				}
+				return
+			}
+			if !errors.Is(err, queue.ErrQueueEmpty) && ctx.Err() == nil {
+				writeRESPError(w, err)
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			w.WriteString("*-1\r\n")
+			return
+		case <-time.After(s.PollInterval):
+		}
+	}
+}
+
+// watchConn 在阻塞期间读取连接，连接断开时取消 ctx。
+// stop 设置读取超时唤醒读取的 goroutine 并等待其退出，之后才能继续使用 r 读取命令，已到达的数据保留在 r 中
+func watchConn(parent context.Context, conn net.Conn, r *bufio.Reader) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(parent)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := r.Peek(1); err != nil {
+			cancel()
+		}
+	}()
+	return ctx, func() {
+		cancel()
+		_ = conn.SetReadDeadline(time.Now())
+		<-done
+		_ = conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// 检查 PUSH/POP 的端是否与 list 的方向一致，方向未确定时以本次命令确定
+func (s *RESPServer) checkSide(name string, q queue.Queue, push bool, side byte) error {
+	lifo := isLIFO(q)
+	pushSide := side
+	if !push && !lifo {
+		pushSide = oppositeSide(side)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if current, ok := s.sides[name]; ok && current != pushSide {
+		popSide := current
+		if !lifo {
+			popSide = oppositeSide(current)
+		}
+		return fmt.Errorf("ERR list '%s' only supports %cPUSH and %cPOP", name, current, popSide)
+	}
+	s.sides[name] = pushSide
+	return nil
+}
+
+func isLIFO(q queue.Queue) bool {
+	switch q.(type) {
+	case *queue.LifoMemoryQueue, *queue.LifoDiskQueue:
+		return true
+	}
+	return false
+}
+
+func oppositeSide(side byte) byte {
+	if side == 'L' {
+		return 'R'
+	}
+	return 'L'
+}
+
+// create 为 false 时 list 不存在返回 nil
+func (s *RESPServer) queue(name string, create bool) (queue.Queue, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if q, ok := s.queues[name]; ok {
+		return q, nil
+	}
+	if !create {
+		return nil, nil
+	}
+	q, err := s.newQueue(name)
+	if err != nil {
+		return nil, err
+	}
+	s.queues[name] = q
+	return q, nil
+}
+
+// 支持 RESP 数组格式及 redis-cli 使用的行内格式，参数超过 maxBulkSize 字节时返回协议错误
+func readCommand(r *bufio.Reader, maxBulkSize int) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > 1024*1024 {
+		return nil, errRESPProtocol
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errRESPProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkSize {
+			return nil, errRESPProtocol
+		}
+		// 按实际到达的数据分块读取，不按声明的长度预先分配
+		buf := bytes.Buffer{}
+		if _, err := io.CopyN(&buf, r, int64(size)+2); err != nil {
+			return nil, err
+		}
+		data := buf.Bytes()
+		if data[size] != '\r' || data[size+1] != '\n' {
+			return nil, errRESPProtocol
+		}
+		args = append(args, string(data[:size]))
+	}
+	return args, nil
+}
+
+// 读取一行，超过 respMaxLineSize 字节时返回协议错误
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > respMaxLineSize {
+			return "", errRESPProtocol
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
+
+func writeBulk(w *bufio.Writer, data []byte) {
+	fmt.Fprintf(w, "$%d\r\n", len(data))
+	w.Write(data)
+	w.WriteString("\r\n")
+}
+
+func writeArgsError(w *bufio.Writer, command string) {
+	fmt.Fprintf(w, "-ERR wrong number of arguments for '%s' command\r\n", strings.ToLower(command))
+}
+
+func writeRESPError(w *bufio.Writer, err error) {
+	message := err.Error()
+	if !strings.HasPrefix(message, "ERR") {
+		message = "ERR " + message
+	}
+	w.WriteString("-" + strings.ReplaceAll(message, "\r\n", " ") + "\r\n")
+}
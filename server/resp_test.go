@@ -0,0 +1,208 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czasg/go-queue"
+)
+
+func startRESPServer(newQueue func(name string) (queue.Queue, error)) (*RESPServer, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	s := NewRESPServer(newQueue)
+	s.PollInterval = time.Millisecond
+	go s.Serve(listener)
+	return s, listener.Addr().String()
+}
+
+type respConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialRESP(addr string) *respConn {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+	return &respConn{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *respConn) do(args ...string) string {
+	buf := strings.Builder{}
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, _ = c.conn.Write([]byte(buf.String()))
+	return c.read()
+}
+
+// 读取一个完整回复，数组和字符串按原样拼接返回
+func (c *respConn) read() string {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return err.Error()
+	}
+	switch line[0] {
+	case '$':
+		var size int
+		fmt.Sscanf(line, "$%d", &size)
+		if size < 0 {
+			return line
+		}
+		buf := make([]byte, size+2)
+		_, _ = io.ReadFull(c.reader, buf)
+		return line + string(buf)
+	case '*':
+		var n int
+		fmt.Sscanf(line, "*%d", &n)
+		for i := 0; i < n; i++ {
+			line += c.read()
+		}
+	}
+	return line
+}
+
+func TestRESPServer(t *testing.T) {
+	name := "TestRESPServer"
+	s, addr := startRESPServer(nil)
+	defer s.Close()
+	c := dialRESP(addr)
+	defer c.conn.Close()
+	cases := [][]string{
+		{"+PONG\r\n", "PING"},
+		{":0\r\n", "LLEN", "list"},
+		{"$-1\r\n", "LPOP", "list"},
+		{":2\r\n", "LPUSH", "list", "a", "b"},
+		// FIFO 队列只能在一端 PUSH、另一端 POP
+		{"-ERR list 'list' only supports LPUSH and RPOP\r\n", "RPUSH", "list", "c"},
+		{"-ERR list 'list' only supports LPUSH and RPOP\r\n", "LPOP", "list"},
+		{"-ERR list 'list' only supports LPUSH and RPOP\r\n", "BLPOP", "list", "0.01"},
+		{":3\r\n", "LPUSH", "list", "c"},
+		{":3\r\n", "LLEN", "list"},
+		{"$1\r\na\r\n", "RPOP", "list"},
+		{"*2\r\n$4\r\nlist\r\n$1\r\nb\r\n", "BRPOP", "other", "list", "1"},
+		{"$1\r\nc\r\n", "RPOP", "list"},
+		{"*-1\r\n", "BRPOP", "list", "0.01"},
+		{"-ERR wrong number of arguments for 'lpush' command\r\n", "LPUSH", "list"},
+		{"-ERR unknown command 'hello'\r\n", "HELLO", "3"},
+	}
+	for _, cs := range cases {
+		if reply := c.do(cs[1:]...); reply != cs[0] {
+			t.Errorf("%s %v 返回 %q 期望 %q", name, cs[1:], reply, cs[0])
+		}
+	}
+	go func() {
+		time.Sleep(time.Millisecond * 20)
+		other := dialRESP(addr)
+		defer other.conn.Close()
+		other.do("LPUSH", "block", "data")
+	}()
+	if reply := c.do("BRPOP", "block", "0"); reply != "*2\r\n$5\r\nblock\r\n$4\r\ndata\r\n" {
+		t.Errorf("%s BRPOP阻塞获取数据 %q", name, reply)
+	}
+	_, _ = c.conn.Write([]byte("PING\r\n"))
+	if reply := c.read(); reply != "+PONG\r\n" {
+		t.Errorf("%s 行内命令 %q", name, reply)
+	}
+}
+
+func TestRESPServerDiskQueue(t *testing.T) {
+	name := "TestRESPServerDiskQueue"
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	newQueue := func(name string) (queue.Queue, error) {
+		return queue.NewLifoDiskQueue(filepath.Join(dir, name))
+	}
+	s, addr := startRESPServer(newQueue)
+	c := dialRESP(addr)
+	c.do("LPUSH", "list", "a", "b")
+	c.conn.Close()
+	_ = s.Close()
+
+	s, addr = startRESPServer(newQueue)
+	defer s.Close()
+	c = dialRESP(addr)
+	defer c.conn.Close()
+	if reply := c.do("LPOP", "list"); reply != "$-1\r\n" {
+		t.Errorf("%s 未创建的list返回空 %q", name, reply)
+	}
+	if reply := c.do("BLPOP", "list", "1"); reply != "*2\r\n$4\r\nlist\r\n$1\r\nb\r\n" {
+		t.Errorf("%s 重启后LIFO磁盘队列获取数据 %q", name, reply)
+	}
+	// LIFO 队列只能在同一端 PUSH/POP
+	if reply := c.do("RPOP", "list"); reply != "-ERR list 'list' only supports LPUSH and LPOP\r\n" {
+		t.Errorf("%s LIFO队列另一端POP返回错误 %q", name, reply)
+	}
+	if reply := c.do("LPOP", "list"); reply != "$1\r\na\r\n" {
+		t.Errorf("%s LIFO磁盘队列获取数据 %q", name, reply)
+	}
+}
+
+func TestRESPServerBlockingPopClosed(t *testing.T) {
+	name := "TestRESPServerBlockingPopClosed"
+	s, addr := startRESPServer(nil)
+	defer s.Close()
+	c := dialRESP(addr)
+	_, _ = c.conn.Write([]byte("*3\r\n$5\r\nBRPOP\r\n$5\r\nblock\r\n$1\r\n0\r\n"))
+	time.Sleep(time.Millisecond * 20)
+	c.conn.Close()
+	time.Sleep(time.Millisecond * 20)
+	other := dialRESP(addr)
+	defer other.conn.Close()
+	other.do("LPUSH", "block", "data")
+	time.Sleep(time.Millisecond * 20)
+	if reply := other.do("LLEN", "block"); reply != ":1\r\n" {
+		t.Errorf("%s 连接断开后不再获取数据 %q", name, reply)
+	}
+	// 阻塞期间到达的命令在返回后继续执行
+	_, _ = other.conn.Write([]byte("*3\r\n$5\r\nBRPOP\r\n$5\r\nempty\r\n$4\r\n0.05\r\nPING\r\n"))
+	if reply := other.read(); reply != "*-1\r\n" {
+		t.Errorf("%s 阻塞超时 %q", name, reply)
+	}
+	if reply := other.read(); reply != "+PONG\r\n" {
+		t.Errorf("%s 阻塞期间到达的命令 %q", name, reply)
+	}
+}
+
+func TestRESPServerLimits(t *testing.T) {
+	name := "TestRESPServerLimits"
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	s := NewRESPServer(nil)
+	s.MaxBulkSize = 5
+	go s.Serve(listener)
+	defer s.Close()
+	addr := listener.Addr().String()
+	c := dialRESP(addr)
+	defer c.conn.Close()
+	if reply := c.do("LPUSH", "list", "data"); reply != ":1\r\n" {
+		t.Errorf("%s 参数未超出限制 %q", name, reply)
+	}
+	if reply := c.do("LPUSH", "list", "larger"); reply != "-ERR protocol error\r\n" {
+		t.Errorf("%s 参数超出限制返回协议错误 %q", name, reply)
+	}
+	c = dialRESP(addr)
+	defer c.conn.Close()
+	_, _ = c.conn.Write([]byte(strings.Repeat("a", respMaxLineSize*2)))
+	if reply := c.read(); reply != "-ERR protocol error\r\n" {
+		t.Errorf("%s 行超出限制返回协议错误 %q", name, reply)
+	}
+}
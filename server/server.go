@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/czasg/go-queue"
+)
+
+var (
+	ErrQueueExists   = errors.New("queue exists")
+	ErrQueueNotFound = errors.New("queue not found")
+)
+
+// 队列错误对应的 HTTP 状态码
+const (
+	StatusQueueEmpty  = http.StatusNoContent
+	StatusQueueFull   = http.StatusInsufficientStorage
+	StatusQueueClosed = http.StatusGone
+	StatusTooLarge    = http.StatusRequestEntityTooLarge
+)
+
+// NewServer 创建 HTTP 队列服务，接口如下：
+//
+//	PUT/POST /queues/{name}?timeout=  请求体作为数据推送
+//	GET      /queues/{name}?timeout=  获取数据，数据作为响应体返回
+//	GET      /queues/{name}/len       获取队列长度
+//	DELETE   /queues/{name}           关闭并移除队列
+//
+// timeout 为空表示不阻塞，为 -1 表示阻塞直到请求断开，其余按 time.ParseDuration 解析。
+func NewServer() *Server {
+	return &Server{
+		PollInterval: time.Millisecond * 10,
+		MaxBodySize:  defaultMaxBodySize,
+	}
+}
+
+// 默认的请求体最大字节数
+const defaultMaxBodySize = 32 << 20
+
+var _ http.Handler = (*Server)(nil)
+
+type Server struct {
+	// 磁盘队列不支持阻塞获取，长轮询时的轮询间隔
+	PollInterval time.Duration
+	// 推送数据的请求体最大字节数，超出时返回 StatusTooLarge，为 0 时使用默认值
+	MaxBodySize int64
+
+	registry
+}
+
+// Close 关闭所有队列
+func (s *Server) Close() error {
+	return s.closeQueues()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/queues/")
+	if path == r.URL.Path || path == "" {
+		http.NotFound(w, r)
+		return
+	}
+	name, action := path, ""
+	if index := strings.LastIndex(path, "/"); index >= 0 {
+		name, action = path[:index], path[index+1:]
+	}
+	q, ok := s.Queue(name)
+	if !ok {
+		http.Error(w, ErrQueueNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	switch {
+	case action == "len" && r.Method == http.MethodGet:
+		_, _ = w.Write([]byte(strconv.Itoa(q.Len())))
+	case action != "":
+		http.NotFound(w, r)
+	case r.Method == http.MethodGet:
+		s.get(w, r, q)
+	case r.Method == http.MethodPut || r.Method == http.MethodPost:
+		s.put(w, r, q)
+	case r.Method == http.MethodDelete:
+		writeError(w, s.remove(name))
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request, q queue.Queue) {
+	ctx, cancel, err := requestContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+	var data []byte
+	if ctx == nil {
+		data, err = q.Get(nil)
+	} else {
+		data, err = queue.GetWait(ctx, q, s.PollInterval)
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		err = queue.ErrQueueEmpty
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if _, err := w.Write(data); err != nil {
+		// 客户端已断开，数据尽量放回队列
+		_ = q.Put(nil, data)
+	}
+}
+
+func (s *Server) put(w http.ResponseWriter, r *http.Request, q queue.Queue) {
+	ctx, cancel, err := requestContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+	limit := s.MaxBodySize
+	if limit <= 0 {
+		limit = defaultMaxBodySize
+	}
+	if r.ContentLength > limit {
+		writeError(w, fmt.Errorf("%w: %d > %d", queue.ErrMessageTooLarge, r.ContentLength, limit))
+		return
+	}
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil && int64(len(data)) >= limit {
+		// MaxBytesReader 读取到 limit 字节后仍有数据时返回错误
+		writeError(w, fmt.Errorf("%w: 请求体超过 %d", queue.ErrMessageTooLarge, limit))
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = q.Put(ctx, data)
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		err = queue.ErrQueueFull
+	}
+	writeError(w, err)
+}
+
+// 根据 timeout 参数生成 Get/Put 使用的 ctx，为 nil 表示不阻塞
+func requestContext(r *http.Request) (context.Context, context.CancelFunc, error) {
+	timeout := r.URL.Query().Get("timeout")
+	switch timeout {
+	case "":
+		return nil, func() {}, nil
+	case "-1":
+		ctx, cancel := context.WithCancel(r.Context())
+		return ctx, cancel, nil
+	}
+	duration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	if duration <= 0 {
+		return nil, func() {}, nil
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), duration)
+	return ctx, cancel, nil
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, queue.ErrQueueEmpty):
+		w.WriteHeader(StatusQueueEmpty)
+	case errors.Is(err, queue.ErrQueueFull):
+		http.Error(w, err.Error(), StatusQueueFull)
+	case errors.Is(err, queue.ErrQueueClosed):
+		http.Error(w, err.Error(), StatusQueueClosed)
+	case errors.Is(err, queue.ErrMessageTooLarge):
+		http.Error(w, err.Error(), StatusTooLarge)
+	case errors.Is(err, ErrQueueNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/czasg/go-queue"
+)
+
+func do(handler http.Handler, method, url string, body []byte) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(method, url, bytes.NewReader(body)))
+	return w
+}
+
+func TestServer(t *testing.T) {
+	name := "TestServer"
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(file.Name())
+	defer os.RemoveAll(file.Name() + ".state")
+	file.Close()
+	disk, err := queue.NewFifoDiskQueue(file.Name())
+	if err != nil {
+		panic(err)
+	}
+	s := NewServer()
+	_ = s.Register("memory", queue.NewFifoMemoryQueue(1))
+	_ = s.Register("disk", disk)
+	if err := s.Register("memory", queue.NewFifoMemoryQueue()); err != ErrQueueExists {
+		t.Error(name, "重复注册返回ErrQueueExists", err)
+	}
+	if w := do(s, http.MethodGet, "/queues/unknown", nil); w.Code != http.StatusNotFound {
+		t.Error(name, "队列不存在返回404", w.Code)
+	}
+	if w := do(s, http.MethodGet, "/queues/memory", nil); w.Code != StatusQueueEmpty {
+		t.Error(name, "空队列返回StatusQueueEmpty", w.Code)
+	}
+	s.MaxBodySize = 2
+	if w := do(s, http.MethodPut, "/queues/memory", []byte("data")); w.Code != StatusTooLarge {
+		t.Error(name, "请求体超出限制返回StatusTooLarge", w.Code)
+	}
+	// 没有 Content-Length 时读取到限制后返回
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/queues/memory", ioutil.NopCloser(bytes.NewReader([]byte("data")))))
+	if w.Code != StatusTooLarge {
+		t.Error(name, "读取请求体超出限制返回StatusTooLarge", w.Code)
+	}
+	s.MaxBodySize = 0
+	if w := do(s, http.MethodPut, "/queues/memory", []byte("data")); w.Code != http.StatusOK {
+		t.Error(name, "推送数据返回200", w.Code)
+	}
+	if w := do(s, http.MethodPost, "/queues/memory", []byte("data")); w.Code != StatusQueueFull {
+		t.Error(name, "满队列返回StatusQueueFull", w.Code)
+	}
+	if w := do(s, http.MethodPost, "/queues/memory?timeout=1ms", []byte("data")); w.Code != StatusQueueFull {
+		t.Error(name, "阻塞推送超时返回StatusQueueFull", w.Code)
+	}
+	if w := do(s, http.MethodGet, "/queues/memory/len", nil); w.Body.String() != "1" {
+		t.Error(name, "获取队列长度", w.Body.String())
+	}
+	if w := do(s, http.MethodGet, "/queues/memory", nil); w.Code != http.StatusOK || w.Body.String() != "data" {
+		t.Error(name, "获取数据", w.Code, w.Body.String())
+	}
+	if w := do(s, http.MethodGet, "/queues/memory?timeout=abc", nil); w.Code != http.StatusBadRequest {
+		t.Error(name, "timeout格式异常返回400", w.Code)
+	}
+	if w := do(s, http.MethodPatch, "/queues/memory", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Error(name, "不支持的方法返回405", w.Code)
+	}
+	go func() {
+		time.Sleep(time.Millisecond * 20)
+		_ = disk.Put(nil, []byte("disk"))
+	}()
+	if w := do(s, http.MethodGet, "/queues/disk?timeout=1s", nil); w.Code != http.StatusOK || w.Body.String() != "disk" {
+		t.Error(name, "磁盘队列长轮询获取数据", w.Code, w.Body.String())
+	}
+	if w := do(s, http.MethodGet, "/queues/disk?timeout=10ms", nil); w.Code != StatusQueueEmpty {
+		t.Error(name, "长轮询超时返回StatusQueueEmpty", w.Code)
+	}
+	q, _ := s.Queue("memory")
+	_ = q.Close()
+	if w := do(s, http.MethodGet, "/queues/memory", nil); w.Code != StatusQueueClosed {
+		t.Error(name, "关闭队列返回StatusQueueClosed", w.Code)
+	}
+	if w := do(s, http.MethodDelete, "/queues/disk", nil); w.Code != http.StatusOK {
+		t.Error(name, "删除队列返回200", w.Code)
+	}
+	if _, ok := s.Queue("disk"); ok {
+		t.Error(name, "删除后队列不存在")
+	}
+	_ = s.Close()
+}
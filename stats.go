@@ -0,0 +1,69 @@
+package queue
+
+import (
+	"sync/atomic"
+)
+
+// Stats 队列状态快照，各字段在同一时刻读取，互相一致。
+// FifoMemoryQueue、RingQueue 不持有锁，计数在 Put/Get 过程中分别更新，并发读写时可能短暂不一致
+type Stats struct {
+	// 数据条数
+	Len int
+	// 内存队列为数据的总字节数；磁盘队列为未读取数据在文件中占用的字节数，包括记录头
+	Bytes int64
+	// 磁盘队列未读取数据在文件中的起止位置，MmapQueue 为跨段的全局位置，内存队列均为 0
+	ReadOffset  int64
+	WriteOffset int64
+	// 打开以来成功的 Put/Get 次数，保留策略丢弃的数据不计入 Gets
+	Puts   int64
+	Gets   int64
+	Closed bool
+}
+
+// StatsQueue 支持获取状态快照的队列，本包中的所有队列都实现了该接口
+type StatsQueue interface {
+	Queue
+	Stats() Stats
+}
+
+// StatsOf queue 实现了 StatsQueue 时返回其 Stats，否则只返回 Len
+func StatsOf(queue Queue) Stats {
+	if q, ok := queue.(StatsQueue); ok {
+		return q.Stats()
+	}
+	return Stats{Len: queue.Len()}
+}
+
+// 不持有锁的内存队列的计数，Put/Get 完成后原子更新。
+// Get 的计数可能先于对应 Put 的计数更新，读取时 Len、Bytes 不小于 0
+type memoryStats struct {
+	bytes int64
+	puts  int64
+	gets  int64
+}
+
+func (s *memoryStats) put(size int) {
+	atomic.AddInt64(&s.bytes, int64(size))
+	atomic.AddInt64(&s.puts, 1)
+}
+
+func (s *memoryStats) get(size int) {
+	atomic.AddInt64(&s.gets, 1)
+	atomic.AddInt64(&s.bytes, -int64(size))
+}
+
+func (s *memoryStats) stats(closed bool) Stats {
+	stats := Stats{
+		Gets:   atomic.LoadInt64(&s.gets),
+		Bytes:  atomic.LoadInt64(&s.bytes),
+		Puts:   atomic.LoadInt64(&s.puts),
+		Closed: closed,
+	}
+	if stats.Puts > stats.Gets {
+		stats.Len = int(stats.Puts - stats.Gets)
+	}
+	if stats.Bytes < 0 {
+		stats.Bytes = 0
+	}
+	return stats
+}
@@ -0,0 +1,158 @@
+package queue
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	name := "TestStats"
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	fifo, err := NewFifoDiskQueue(dir + "/fifo")
+	if err != nil {
+		panic(err)
+	}
+	lifo, err := NewLifoDiskQueue(dir + "/lifo")
+	if err != nil {
+		panic(err)
+	}
+	log, err := NewLogDiskQueue(dir + "/log")
+	if err != nil {
+		panic(err)
+	}
+	for label, queue := range map[string]Queue{
+		"FifoMemoryQueue":   NewFifoMemoryQueue(8),
+		"LifoMemoryQueue":   NewLifoMemoryQueue(8),
+		"RingQueue":         NewRingQueue(8),
+		"FifoDiskQueue":     fifo,
+		"LifoDiskQueue":     lifo,
+		"LogDiskQueue":      log,
+		"InstrumentedQueue": NewInstrumentedQueue("stats", NewFifoMemoryQueue(8)),
+		"RateLimitedQueue":  NewRateLimitedQueue(NewLifoMemoryQueue(8), Limit{}, Limit{}),
+	} {
+		_, disk := queue.(StreamQueue)
+		disk = disk || label == "LogDiskQueue"
+		for _, data := range []string{"data", "large data", "more"} {
+			_ = queue.Put(nil, []byte(data))
+		}
+		data, err := queue.Get(nil)
+		if err != nil {
+			t.Fatal(name, label, "读取数据", err)
+		}
+		stats := StatsOf(queue)
+		if stats.Len != 2 || stats.Len != queue.Len() || stats.Puts != 3 || stats.Gets != 1 || stats.Closed {
+			t.Error(name, label, "计数", stats)
+		}
+		if disk {
+			// 磁盘队列的字节数包括记录头
+			if stats.Bytes != stats.WriteOffset-stats.ReadOffset || stats.Bytes <= int64(18-len(data)) {
+				t.Error(name, label, "磁盘队列位置", stats)
+			}
+		} else if stats.Bytes != int64(18-len(data)) || stats.ReadOffset != 0 || stats.WriteOffset != 0 {
+			t.Error(name, label, "内存队列字节数", stats)
+		}
+		for {
+			if _, err := queue.Get(nil); err != nil {
+				break
+			}
+		}
+		if stats := StatsOf(queue); stats.Len != 0 || stats.Bytes != 0 || stats.Gets != 3 {
+			t.Error(name, label, "读取全部数据", stats)
+		}
+		_ = queue.Close()
+		if stats := StatsOf(queue); !stats.Closed || stats.Puts != 3 {
+			t.Error(name, label, "关闭后的状态", stats)
+		}
+	}
+	if stats := StatsOf(plainQueue{NewFifoMemoryQueue(8)}); stats != (Stats{}) {
+		t.Error(name, "未实现StatsQueue只返回Len", stats)
+	}
+}
+
+func TestDiskQueueStatsReopen(t *testing.T) {
+	name := "TestDiskQueueStatsReopen"
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	for label, open := range map[string]func(string, ...DiskOption) (Queue, error){
+		"FifoDiskQueue": NewFifoDiskQueue,
+		"LifoDiskQueue": NewLifoDiskQueue,
+	} {
+		queue, err := open(dir + "/" + label)
+		if err != nil {
+			panic(err)
+		}
+		_ = queue.Put(nil, []byte("data"))
+		_ = queue.Put(nil, []byte("data"))
+		_, _ = queue.Get(nil)
+		before := StatsOf(queue)
+		_ = queue.Close()
+		queue, err = open(dir + "/" + label)
+		if err != nil {
+			panic(err)
+		}
+		// 条数、位置从状态文件恢复，Put/Get 次数从重新打开开始计算
+		after := StatsOf(queue)
+		if after.Len != 1 || after.Bytes != before.Bytes || after.Puts != 0 || after.Gets != 0 {
+			t.Error(name, label, "重新打开后的状态", before, after)
+		}
+		_ = queue.Close()
+	}
+}
+
+// 并发 Put/Get 时读取 Len、Stats，配合 -race 检查数据竞争
+func TestDiskQueueStatsConcurrent(t *testing.T) {
+	name := "TestDiskQueueStatsConcurrent"
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	for label, open := range map[string]func(string, ...DiskOption) (Queue, error){
+		"FifoDiskQueue": NewFifoDiskQueue,
+		"LifoDiskQueue": NewLifoDiskQueue,
+	} {
+		queue, err := open(dir + "/" + label)
+		if err != nil {
+			panic(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		wg := sync.WaitGroup{}
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for ctx.Err() == nil {
+					stats := StatsOf(queue)
+					// 同一快照中的字段互相一致
+					if stats.Len < 0 || stats.Len != int(stats.Puts-stats.Gets) || stats.Bytes != stats.WriteOffset-stats.ReadOffset {
+						t.Error(name, label, "快照不一致", stats)
+						return
+					}
+					_ = queue.Len()
+				}
+			}()
+		}
+		for i := 0; i < 200; i++ {
+			_ = queue.Put(nil, []byte("data"))
+			if i%2 == 0 {
+				_, _ = queue.Get(nil)
+			}
+		}
+		cancel()
+		wg.Wait()
+		if stats := StatsOf(queue); stats.Len != 100 || stats.Puts != 200 || stats.Gets != 100 {
+			t.Error(name, label, "最终状态", stats)
+		}
+		_ = queue.Close()
+	}
+}
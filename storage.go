@@ -0,0 +1,259 @@
+package queue
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Storage 磁盘队列的存储后端，通过 WithStorage 指定，默认为 OSStorage。
+// 目前仅 FifoDiskQueue、LifoDiskQueue 支持。
+type Storage interface {
+	// Open 以读写方式打开文件，不存在时创建。同一文件可以同时打开多次，各自维护读写位置
+	Open(name string) (File, error)
+}
+
+// File 的语义与 *os.File 一致
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+	Truncate(size int64) error
+	Sync() error
+	Stat() (os.FileInfo, error)
+}
+
+var _ Storage = OSStorage{}
+
+// OSStorage 本地文件系统
+type OSStorage struct{}
+
+func (OSStorage) Open(name string) (File, error) {
+	return os.OpenFile(name, os.O_RDWR|os.O_CREATE, os.ModePerm)
+}
+
+// NewMemoryStorage 内存文件系统，用于测试，Close 后数据仍然保留，可以重新打开
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{files: map[string]*memoryData{}}
+}
+
+var _ Storage = (*MemoryStorage)(nil)
+
+type MemoryStorage struct {
+	lock  sync.Mutex
+	files map[string]*memoryData
+}
+
+func (s *MemoryStorage) Open(name string) (File, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	data, ok := s.files[name]
+	if !ok {
+		data = &memoryData{name: name, modTime: time.Now()}
+		s.files[name] = data
+	}
+	return &memoryFile{data: data}, nil
+}
+
+// Bytes 返回文件内容的副本，文件不存在时返回 nil
+func (s *MemoryStorage) Bytes(name string) []byte {
+	s.lock.Lock()
+	data, ok := s.files[name]
+	s.lock.Unlock()
+	if !ok {
+		return nil
+	}
+	data.lock.RLock()
+	defer data.lock.RUnlock()
+	return append([]byte{}, data.buf...)
+}
+
+// SetBytes 覆盖文件内容，用于构造异常文件
+func (s *MemoryStorage) SetBytes(name string, buf []byte) {
+	s.lock.Lock()
+	data, ok := s.files[name]
+	if !ok {
+		data = &memoryData{name: name}
+		s.files[name] = data
+	}
+	s.lock.Unlock()
+	data.lock.Lock()
+	defer data.lock.Unlock()
+	data.buf = append([]byte{}, buf...)
+	data.modTime = time.Now()
+}
+
+type memoryData struct {
+	name    string
+	lock    sync.RWMutex
+	buf     []byte
+	modTime time.Time
+}
+
+type memoryFile struct {
+	data   *memoryData
+	lock   sync.Mutex
+	offset int64
+	closed bool
+}
+
+func (f *memoryFile) Read(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	n, err := f.readAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memoryFile) ReadAt(p []byte, off int64) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	n, err := f.readAt(p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *memoryFile) readAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	f.data.lock.RLock()
+	defer f.data.lock.RUnlock()
+	if off >= int64(len(f.data.buf)) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	return copy(p, f.data.buf[off:]), nil
+}
+
+func (f *memoryFile) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	n, err := f.writeAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memoryFile) WriteAt(p []byte, off int64) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	return f.writeAt(p, off)
+}
+
+func (f *memoryFile) writeAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	f.data.lock.Lock()
+	defer f.data.lock.Unlock()
+	if end := off + int64(len(p)); end > int64(len(f.data.buf)) {
+		f.data.buf = append(f.data.buf, make([]byte, end-int64(len(f.data.buf)))...)
+	}
+	f.data.modTime = time.Now()
+	return copy(f.data.buf[off:], p), nil
+}
+
+func (f *memoryFile) Seek(offset int64, whence int) (int64, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		f.data.lock.RLock()
+		offset += int64(len(f.data.buf))
+		f.data.lock.RUnlock()
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memoryFile) Truncate(size int64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if size < 0 {
+		return errors.New("negative size")
+	}
+	f.data.lock.Lock()
+	defer f.data.lock.Unlock()
+	if size <= int64(len(f.data.buf)) {
+		f.data.buf = f.data.buf[:size]
+	} else {
+		f.data.buf = append(f.data.buf, make([]byte, size-int64(len(f.data.buf)))...)
+	}
+	f.data.modTime = time.Now()
+	return nil
+}
+
+func (f *memoryFile) Sync() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	return nil
+}
+
+func (f *memoryFile) Stat() (os.FileInfo, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return nil, os.ErrClosed
+	}
+	f.data.lock.RLock()
+	defer f.data.lock.RUnlock()
+	return memoryFileInfo{name: f.data.name, size: int64(len(f.data.buf)), modTime: f.data.modTime}, nil
+}
+
+func (f *memoryFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	return nil
+}
+
+type memoryFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i memoryFileInfo) Name() string       { return i.name }
+func (i memoryFileInfo) Size() int64        { return i.size }
+func (i memoryFileInfo) Mode() os.FileMode  { return os.ModePerm }
+func (i memoryFileInfo) ModTime() time.Time { return i.modTime }
+func (i memoryFileInfo) IsDir() bool        { return false }
+func (i memoryFileInfo) Sys() interface{}   { return nil }
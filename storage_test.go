@@ -0,0 +1,120 @@
+package queue
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"syscall"
+	"testing"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	name := "TestMemoryStorage"
+	storage := NewMemoryStorage()
+	writer, _ := storage.Open("test")
+	reader, _ := storage.Open("test")
+	_, _ = writer.Write([]byte("hello world"))
+	buf := make([]byte, 5)
+	if _, err := reader.Read(buf); err != nil || string(buf) != "hello" {
+		t.Error(name, "多个句柄共享文件内容", string(buf), err)
+	}
+	if offset, _ := reader.Seek(-5, io.SeekEnd); offset != 6 {
+		t.Error(name, "从末尾定位", offset)
+	}
+	_ = writer.Truncate(8)
+	if n, err := reader.Read(buf); n != 2 || err != nil {
+		t.Error(name, "截断后读取", n, err)
+	}
+	if _, err := reader.Read(buf); err != io.EOF {
+		t.Error(name, "读取到末尾", err)
+	}
+	if stat, _ := writer.Stat(); stat.Size() != 8 {
+		t.Error(name, "文件大小", stat.Size())
+	}
+	_ = writer.Close()
+	_ = reader.Close()
+	if _, err := writer.Write(buf); err == nil {
+		t.Error(name, "关闭后写入")
+	}
+	if !bytes.Equal(storage.Bytes("test"), []byte("hello wo")) {
+		t.Error(name, "关闭后保留数据", string(storage.Bytes("test")))
+	}
+}
+
+func TestDiskQueueMemoryStorage(t *testing.T) {
+	name := "TestDiskQueueMemoryStorage"
+	storage := NewMemoryStorage()
+	for _, newQueue := range []func(file string, options ...DiskOption) (Queue, error){
+		NewFifoDiskQueue, NewLifoDiskQueue,
+	} {
+		queue, err := newQueue("queue", WithStorage(storage))
+		if err != nil {
+			panic(err)
+		}
+		for i := 0; i < 10; i++ {
+			_ = queue.Put(nil, []byte{byte(i)})
+		}
+		_, _ = queue.Get(nil)
+		_ = queue.Close()
+		queue, err = newQueue("queue", WithStorage(storage))
+		if err != nil {
+			panic(err)
+		}
+		if queue.Len() != 9 {
+			t.Error(name, "重新打开后的队列长度", queue.Len())
+		}
+		for queue.Len() > 0 {
+			_, _ = queue.Get(nil)
+		}
+		_ = queue.Close()
+		if len(storage.Bytes("queue")) != 0 {
+			t.Error(name, "队列为空时清空文件")
+		}
+	}
+}
+
+func TestFaultStorage(t *testing.T) {
+	name := "TestFaultStorage"
+	storage := NewFaultStorage(NewMemoryStorage())
+	storage.Inject(Fault{Op: FaultOpen, Times: 1})
+	if _, err := NewFifoDiskQueue("queue", WithStorage(storage)); !errors.Is(err, ErrInjectedFault) {
+		t.Error(name, "打开文件失败", err)
+	}
+	queue, err := NewFifoDiskQueue("queue", WithStorage(storage))
+	if err != nil {
+		panic(err)
+	}
+	writes := storage.Ops(FaultWrite)
+	// 每次 Put 写入数据文件及状态文件
+	storage.Inject(Fault{Op: FaultWrite, After: 2, Times: 1, Err: syscall.ENOSPC})
+	if err := queue.Put(nil, []byte("data")); err != nil {
+		t.Error(name, "第一次写入成功", err)
+	}
+	if err := queue.Put(nil, []byte("data")); err != syscall.ENOSPC {
+		t.Error(name, "磁盘空间不足", err)
+	}
+	if storage.Ops(FaultWrite)-writes != 3 {
+		t.Error(name, "写入次数", storage.Ops(FaultWrite)-writes)
+	}
+	storage.Inject(Fault{Op: FaultTruncate})
+	if err := queue.Close(); !errors.Is(err, ErrInjectedFault) {
+		t.Error(name, "关闭时截断失败", err)
+	}
+	storage.Reset()
+
+	memory := NewMemoryStorage()
+	storage = NewFaultStorage(memory)
+	file, _ := storage.Open("short")
+	storage.Inject(Fault{Op: FaultWrite, Short: true})
+	if n, err := file.Write([]byte("data")); n != 2 || err != ErrInjectedFault {
+		t.Error(name, "短写", n, err)
+	}
+	if string(memory.Bytes("short")) != "da" {
+		t.Error(name, "短写的数据", string(memory.Bytes("short")))
+	}
+	storage.Inject(Fault{Op: FaultSync})
+	if err := file.Sync(); err != ErrInjectedFault {
+		t.Error(name, "同步失败", err)
+	}
+	_ = file.Close()
+}
@@ -0,0 +1,111 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// StreamQueue 支持流式读写的队列，数据不需要一次性放入内存，FifoDiskQueue、LifoDiskQueue 实现了该接口。
+// 流式读写期间持有队列锁，同一队列的其他操作会等待其完成。
+type StreamQueue interface {
+	Queue
+	// PutReader 从 r 读取 size 字节作为一条数据写入，全部写入后数据才对 Get 可见，r 提前结束时返回 io.ErrUnexpectedEOF
+	PutReader(ctx context.Context, r io.Reader, size int64) error
+	// GetWriter 将一条数据写入 w，返回写入的字节数，写入失败时数据保留在队列中
+	GetWriter(ctx context.Context, w io.Writer) (int64, error)
+	// GetReader 返回一条数据的读取器，读取完毕并 Close 后才从队列中移除，未读取完毕时 Close 数据保留在队列中。
+	// Close 之前持有队列锁，调用方必须 Close
+	GetReader(ctx context.Context) (*RecordReader, error)
+}
+
+var errNegativeSize = errors.New("negative size")
+
+// 流式读写时每次复制的字节数
+const streamBufferSize = 32 * 1024
+
+// RecordReader GetReader 返回的数据读取器，ctx 取消后 Read 返回 ctx.Err()
+type RecordReader struct {
+	reader *io.SectionReader
+	ctx    context.Context
+	read   int64
+	closed bool
+	once   sync.Once
+	done   func(read bool) error
+}
+
+func (r *RecordReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if r.ctx != nil {
+		if err := r.ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+// Size 数据的字节数
+func (r *RecordReader) Size() int64 {
+	return r.reader.Size()
+}
+
+// Close 释放队列锁，数据已读取完毕时从队列中移除
+func (r *RecordReader) Close() error {
+	var err error
+	r.once.Do(func() {
+		r.closed = true
+		err = r.done(r.read == r.reader.Size())
+	})
+	return err
+}
+
+// 在 offset 位置顺序写入文件
+type offsetWriter struct {
+	file   File
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.file.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// 分块从 r 复制 size 字节到 w，每块复制前检查 ctx，ctx 为 nil 时不检查
+func copyStream(ctx context.Context, w io.Writer, r io.Reader, size int64) (int64, error) {
+	buffer := getBuffer(int(min64(streamBufferSize, size)))
+	defer putBuffer(buffer)
+	buf := *buffer
+	var written int64
+	for written < size {
+		if ctx != nil {
+			if err := ctx.Err(); err != nil {
+				return written, err
+			}
+		}
+		n, err := r.Read(buf[:min64(int64(len(buf)), size-written)])
+		if n > 0 {
+			m, err := w.Write(buf[:n])
+			written += int64(m)
+			if err != nil {
+				return written, err
+			}
+			if m < n {
+				return written, io.ErrShortWrite
+			}
+		}
+		if err == io.EOF && written < size {
+			return written, io.ErrUnexpectedEOF
+		}
+		if err != nil && err != io.EOF {
+			return written, err
+		}
+	}
+	return written, nil
+}
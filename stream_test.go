@@ -0,0 +1,97 @@
+package queue
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, ErrInjectedFault
+}
+
+func testStreamQueue(t *testing.T, name string, newQueue func(file string, options ...DiskOption) (Queue, error)) {
+	storage := NewMemoryStorage()
+	q, err := newQueue("queue", WithStorage(storage))
+	if err != nil {
+		panic(err)
+	}
+	queue := q.(StreamQueue)
+	large := bytes.Repeat([]byte("0123456789"), 10*1024)
+	if err := queue.PutReader(nil, bytes.NewReader(large), int64(len(large))); err != nil || queue.Len() != 1 {
+		t.Error(name, "流式写入数据", err, queue.Len())
+	}
+	if err := queue.PutReader(nil, bytes.NewReader(large), int64(len(large))+1); !errors.Is(err, io.ErrUnexpectedEOF) || queue.Len() != 1 {
+		t.Error(name, "数据不足时返回ErrUnexpectedEOF且不可见", err, queue.Len())
+	}
+	if err := queue.PutReader(nil, bytes.NewReader(nil), -1); err == nil {
+		t.Error(name, "长度为负数返回错误", err)
+	}
+	if _, err := queue.GetWriter(nil, errWriter{}); !errors.Is(err, ErrInjectedFault) || queue.Len() != 1 {
+		t.Error(name, "写入失败时数据保留在队列中", err, queue.Len())
+	}
+	buf := bytes.NewBuffer(nil)
+	if n, err := queue.GetWriter(nil, buf); err != nil || n != int64(len(large)) || !bytes.Equal(buf.Bytes(), large) || queue.Len() != 0 {
+		t.Error(name, "流式读取数据", n, err, queue.Len())
+	}
+	if _, err := queue.GetWriter(nil, buf); !errors.Is(err, ErrQueueEmpty) {
+		t.Error(name, "空队列返回ErrQueueEmpty", err)
+	}
+
+	_ = queue.Put(nil, []byte("data"))
+	reader, err := queue.GetReader(nil)
+	if err != nil || reader.Size() != 4 {
+		t.Fatal(name, "获取读取器", err)
+	}
+	part := make([]byte, 2)
+	_, _ = reader.Read(part)
+	if err := reader.Close(); err != nil || queue.Len() != 1 {
+		t.Error(name, "未读取完毕时数据保留在队列中", err, queue.Len())
+	}
+	if _, err := reader.Read(part); err == nil {
+		t.Error(name, "关闭后读取返回错误", err)
+	}
+	reader, err = queue.GetReader(nil)
+	if err != nil {
+		t.Fatal(name, "获取读取器", err)
+	}
+	if data, err := ioutil.ReadAll(reader); err != nil || string(data) != "data" {
+		t.Error(name, "读取器读取数据", string(data), err)
+	}
+	if err := reader.Close(); err != nil || queue.Len() != 0 {
+		t.Error(name, "读取完毕后移除数据", err, queue.Len())
+	}
+	_ = queue.Close()
+
+	// 写入中途失败，重新打开后数据不可见
+	fault := NewFaultStorage(storage)
+	q, err = newQueue("queue", WithStorage(fault))
+	if err != nil {
+		panic(err)
+	}
+	_ = q.Put(nil, []byte("a"))
+	fault.Inject(Fault{Op: FaultWrite, After: 1})
+	if err := q.(StreamQueue).PutReader(nil, bytes.NewReader(large), int64(len(large))); !errors.Is(err, ErrInjectedFault) {
+		t.Error(name, "写入失败返回错误", err)
+	}
+	q, err = newQueue("queue", WithStorage(storage))
+	if err != nil {
+		panic(err)
+	}
+	defer q.Close()
+	if data, err := q.Get(nil); string(data) != "a" || err != nil || q.Len() != 0 {
+		t.Error(name, "写入失败的数据重新打开后不可见", string(data), err, q.Len())
+	}
+}
+
+func TestFifoDiskQueueStream(t *testing.T) {
+	testStreamQueue(t, "TestFifoDiskQueueStream", NewFifoDiskQueue)
+}
+
+func TestLifoDiskQueueStream(t *testing.T) {
+	testStreamQueue(t, "TestLifoDiskQueueStream", NewLifoDiskQueue)
+}
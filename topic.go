@@ -0,0 +1,284 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrSubscriberExists   = errors.New("subscriber exists")
+	ErrSubscriberNotFound = errors.New("subscriber not found")
+)
+
+// 订阅者队列满时的处理策略
+type OverflowPolicy int
+
+const (
+	OverflowBlock OverflowPolicy = iota
+	OverflowDrop
+	OverflowError
+)
+
+const topicRegistry = "subscribers"
+
+type subscriber struct {
+	queue   Queue
+	policy  OverflowPolicy
+	durable bool
+}
+
+// NewTopic 创建主题，dir 非空时订阅者注册信息及磁盘订阅者队列保存在 dir 下，重新打开时自动恢复。
+func NewTopic(dir string) (*Topic, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	topic := Topic{
+		dir:         dir,
+		subscribers: map[string]*subscriber{},
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	if dir == "" {
+		return &topic, nil
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, topicRegistry))
+	if os.IsNotExist(err) {
+		return &topic, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != 2 {
+			_ = topic.Close()
+			return nil, fmt.Errorf("%s 格式异常", line)
+		}
+		policy, err := strconv.Atoi(fields[1])
+		if err != nil {
+			_ = topic.Close()
+			return nil, err
+		}
+		queue, err := NewFifoDiskQueue(topic.queueFile(fields[0]))
+		if err != nil {
+			_ = topic.Close()
+			return nil, err
+		}
+		topic.subscribers[fields[0]] = &subscriber{
+			queue:   queue,
+			policy:  OverflowPolicy(policy),
+			durable: true,
+		}
+	}
+	return &topic, nil
+}
+
+type Topic struct {
+	dir         string
+	lock        sync.RWMutex
+	subscribers map[string]*subscriber
+	closed      bool
+	// Close 时取消，唤醒阻塞中的 Publish
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Subscribe 注册运行时订阅者，不做持久化
+func (t *Topic) Subscribe(name string, queue Queue, policy OverflowPolicy) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.check(name); err != nil {
+		return err
+	}
+	t.subscribers[name] = &subscriber{queue: queue, policy: policy}
+	return nil
+}
+
+// SubscribeDisk 注册持久化订阅者，数据保存在 dir 下的 FifoDiskQueue 中
+func (t *Topic) SubscribeDisk(name string, policy OverflowPolicy) (Queue, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.dir == "" {
+		return nil, errors.New("topic dir not set")
+	}
+	if err := t.check(name); err != nil {
+		return nil, err
+	}
+	if strings.ContainsAny(name, ",\n/\\") {
+		return nil, fmt.Errorf("invalid subscriber name %q", name)
+	}
+	queue, err := NewFifoDiskQueue(t.queueFile(name))
+	if err != nil {
+		return nil, err
+	}
+	t.subscribers[name] = &subscriber{queue: queue, policy: policy, durable: true}
+	if err := t.save(); err != nil {
+		delete(t.subscribers, name)
+		_ = queue.Close()
+		return nil, err
+	}
+	return queue, nil
+}
+
+// Unsubscribe 移除订阅者并关闭其队列，持久化订阅者的数据文件会被删除
+func (t *Topic) Unsubscribe(name string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	sub, ok := t.subscribers[name]
+	if !ok {
+		return ErrSubscriberNotFound
+	}
+	delete(t.subscribers, name)
+	err := sub.queue.Close()
+	if !sub.durable {
+		return err
+	}
+	if err := t.save(); err != nil {
+		return err
+	}
+	if err := os.Remove(t.queueFile(name)); err != nil {
+		return err
+	}
+	return os.Remove(diskStateFile(t.queueFile(name)))
+}
+
+func (t *Topic) Subscriber(name string) (Queue, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	sub, ok := t.subscribers[name]
+	if !ok {
+		return nil, false
+	}
+	return sub.queue, true
+}
+
+// Publish 将数据推送给所有订阅者，单个订阅者失败不影响其他订阅者，返回第一个错误。
+// OverflowBlock 策略下 ctx 为 nil 时一直阻塞到推送成功或主题关闭。
+// 推送时不持有锁，阻塞的 Publish 不影响 Subscribe、Unsubscribe、Close，推送过程中被移除的订阅者返回其队列的错误。
+func (t *Topic) Publish(ctx context.Context, data []byte) error {
+	t.lock.RLock()
+	if t.closed {
+		t.lock.RUnlock()
+		return ErrQueueClosed
+	}
+	names := make([]string, 0, len(t.subscribers))
+	subs := make([]*subscriber, 0, len(t.subscribers))
+	for name, sub := range t.subscribers {
+		names = append(names, name)
+		subs = append(subs, sub)
+	}
+	t.lock.RUnlock()
+	var putCtx context.Context
+	cancel := func() {}
+	defer func() { cancel() }()
+	var first error
+	for i, sub := range subs {
+		var err error
+		switch sub.policy {
+		case OverflowBlock:
+			// 先尝试不阻塞推送，队列满时才需要同时等待 ctx 与主题关闭
+			err = sub.queue.Put(nil, data)
+			if errors.Is(err, ErrQueueFull) {
+				if putCtx == nil {
+					putCtx, cancel = t.context(ctx)
+				}
+				err = sub.queue.Put(putCtx, data)
+			}
+			if err != nil && t.ctx.Err() != nil {
+				err = ErrQueueClosed
+			}
+		case OverflowDrop:
+			err = sub.queue.Put(nil, data)
+			if errors.Is(err, ErrQueueFull) {
+				err = nil
+			}
+		default:
+			err = sub.queue.Put(nil, data)
+		}
+		if err != nil && first == nil {
+			first = fmt.Errorf("subscriber %s: %w", names[i], err)
+		}
+	}
+	return first
+}
+
+// 返回阻塞推送使用的 ctx，调用方 ctx 失效或主题关闭时取消。
+// 调用方 ctx 不会失效时直接使用主题的 ctx，否则需要一个 goroutine 等待两者之一
+func (t *Topic) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil || ctx.Done() == nil {
+		return t.ctx, func() {}
+	}
+	putCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-t.ctx.Done():
+			cancel()
+		case <-putCtx.Done():
+		}
+	}()
+	return putCtx, cancel
+}
+
+// Close 关闭所有订阅者队列，持久化订阅者的注册信息保留
+func (t *Topic) Close() error {
+	// 先唤醒阻塞中的 Publish
+	t.cancel()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	var first error
+	for _, sub := range t.subscribers {
+		if err := sub.queue.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (t *Topic) check(name string) error {
+	if t.closed {
+		return ErrQueueClosed
+	}
+	if _, ok := t.subscribers[name]; ok {
+		return ErrSubscriberExists
+	}
+	return nil
+}
+
+func (t *Topic) queueFile(name string) string {
+	return filepath.Join(t.dir, name+".queue")
+}
+
+func (t *Topic) save() error {
+	names := []string{}
+	for name, sub := range t.subscribers {
+		if sub.durable {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	buf := strings.Builder{}
+	for _, name := range names {
+		buf.WriteString(fmt.Sprintf("%s,%d\n", name, t.subscribers[name].policy))
+	}
+	file := filepath.Join(t.dir, topicRegistry)
+	if err := ioutil.WriteFile(file+".tmp", []byte(buf.String()), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
@@ -0,0 +1,164 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTopic(t *testing.T) {
+	name := "TestTopic"
+	topic, err := NewTopic("")
+	if err != nil {
+		panic(err)
+	}
+	fifo := NewFifoMemoryQueue(1)
+	lifo := NewLifoMemoryQueue(1)
+	drop := NewFifoMemoryQueue(1)
+	if err := topic.Subscribe("fifo", fifo, OverflowError); err != nil {
+		t.Error(name, "订阅返回nil", err)
+	}
+	if err := topic.Subscribe("fifo", fifo, OverflowError); !errors.Is(err, ErrSubscriberExists) {
+		t.Error(name, "重复订阅返回ErrSubscriberExists", err)
+	}
+	_ = topic.Subscribe("lifo", lifo, OverflowBlock)
+	_ = topic.Subscribe("drop", drop, OverflowDrop)
+	if _, err := topic.SubscribeDisk("disk", OverflowBlock); err == nil {
+		t.Error(name, "未指定目录时持久化订阅返回异常")
+	}
+	if err := topic.Publish(context.Background(), []byte("data")); err != nil {
+		t.Error(name, "发布返回nil", err)
+	}
+	for _, queue := range []Queue{fifo, lifo, drop} {
+		if length := queue.Len(); length != 1 {
+			t.Error(name, "每个订阅者收到数据", length)
+		}
+	}
+	_ = topic.Unsubscribe("lifo")
+	if _, ok := topic.Subscriber("lifo"); ok {
+		t.Error(name, "取消订阅后订阅者不存在")
+	}
+	if err := topic.Unsubscribe("lifo"); !errors.Is(err, ErrSubscriberNotFound) {
+		t.Error(name, "重复取消订阅返回ErrSubscriberNotFound", err)
+	}
+	if err := topic.Publish(nil, []byte("data")); !errors.Is(err, ErrQueueFull) {
+		t.Error(name, "OverflowError订阅者满返回ErrQueueFull", err)
+	}
+	_, _ = fifo.Get(nil)
+	if err := topic.Publish(nil, []byte("data")); err != nil {
+		t.Error(name, "OverflowDrop订阅者满时丢弃数据", err)
+	}
+	_ = topic.Close()
+	if err := topic.Publish(nil, []byte("data")); !errors.Is(err, ErrQueueClosed) {
+		t.Error(name, "关闭后发布返回ErrQueueClosed", err)
+	}
+}
+
+func TestTopicDurable(t *testing.T) {
+	name := "TestTopicDurable"
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	topic, err := NewTopic(dir)
+	if err != nil {
+		panic(err)
+	}
+	if _, err := topic.SubscribeDisk("a", OverflowBlock); err != nil {
+		t.Error(name, "持久化订阅返回nil", err)
+	}
+	_, _ = topic.SubscribeDisk("b", OverflowError)
+	_ = topic.Subscribe("memory", NewFifoMemoryQueue(), OverflowBlock)
+	_ = topic.Publish(nil, []byte("data"))
+	_ = topic.Close()
+
+	topic, err = NewTopic(dir)
+	if err != nil {
+		panic(err)
+	}
+	if _, ok := topic.Subscriber("memory"); ok {
+		t.Error(name, "运行时订阅者不恢复")
+	}
+	for _, sub := range []string{"a", "b"} {
+		queue, ok := topic.Subscriber(sub)
+		if !ok {
+			t.Error(name, "持久化订阅者恢复", sub)
+			continue
+		}
+		if data, err := queue.Get(nil); string(data) != "data" || err != nil {
+			t.Error(name, "持久化订阅者数据恢复", sub, data, err)
+		}
+	}
+	if err := topic.Unsubscribe("b"); err != nil {
+		t.Error(name, "取消持久化订阅", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "b.*")); len(files) != 0 {
+		t.Error(name, "取消订阅后删除队列文件", files)
+	}
+	_ = topic.Close()
+
+	topic, err = NewTopic(dir)
+	if err != nil {
+		panic(err)
+	}
+	defer topic.Close()
+	if _, ok := topic.Subscriber("b"); ok {
+		t.Error(name, "取消订阅后不再恢复")
+	}
+	if _, ok := topic.Subscriber("a"); !ok {
+		t.Error(name, "未取消订阅者继续恢复")
+	}
+}
+
+// Close 不关闭底层队列，阻塞的 Put 只能通过 ctx 唤醒
+type unclosableQueue struct {
+	Queue
+}
+
+func (unclosableQueue) Close() error {
+	return nil
+}
+
+func TestTopicCloseWhilePublishBlocked(t *testing.T) {
+	name := "TestTopicCloseWhilePublishBlocked"
+	topic, err := NewTopic("")
+	if err != nil {
+		panic(err)
+	}
+	_ = topic.Subscribe("block", unclosableQueue{NewFifoMemoryQueue(1)}, OverflowBlock)
+	_ = topic.Publish(nil, []byte("data"))
+	published := make(chan error, 1)
+	go func() {
+		published <- topic.Publish(nil, []byte("data"))
+	}()
+	time.Sleep(time.Millisecond * 10)
+	// 推送阻塞时不影响订阅
+	if err := topic.Subscribe("other", NewFifoMemoryQueue(1), OverflowBlock); err != nil {
+		t.Error(name, "阻塞推送时订阅", err)
+	}
+	closed := make(chan error, 1)
+	go func() {
+		closed <- topic.Close()
+	}()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Error(name, "关闭返回nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal(name, "阻塞推送时关闭不应阻塞")
+	}
+	select {
+	case err := <-published:
+		if !errors.Is(err, ErrQueueClosed) {
+			t.Error(name, "关闭后阻塞的推送返回ErrQueueClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal(name, "关闭后唤醒阻塞的推送")
+	}
+}
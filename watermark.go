@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"sync"
+)
+
+// Watermark 队列深度水位线，条数或字节数任一达到高水位时进入高压状态，
+// 全部回落到低水位及以下时恢复，高低水位之间保持原状态以避免频繁切换。
+// 高水位为 0 表示不检查该项。
+type Watermark struct {
+	HighItems int
+	LowItems  int
+	HighBytes int64
+	LowBytes  int64
+	// OnHigh 进入高压状态时回调，OnLow 恢复时回调，回调时可能持有队列锁，不能在回调中调用该队列的方法
+	OnHigh func(items int, bytes int64)
+	OnLow  func(items int, bytes int64)
+}
+
+func (w Watermark) high(items int, bytes int64) bool {
+	return (w.HighItems > 0 && items >= w.HighItems) ||
+		(w.HighBytes > 0 && bytes >= w.HighBytes)
+}
+
+func (w Watermark) low(items int, bytes int64) bool {
+	return (w.HighItems <= 0 || items <= w.LowItems) &&
+		(w.HighBytes <= 0 || bytes <= w.LowBytes)
+}
+
+// NewWatermarkObserver 根据队列事件跟踪队列深度，通过 AddObserver 或 WithObserver 注册到队列。
+// 磁盘队列需通过 WithObserver 注册，才能从 EventRecovered 获取已有数据的深度。
+func NewWatermarkObserver(watermark Watermark) *WatermarkObserver {
+	return &WatermarkObserver{watermark: watermark}
+}
+
+var _ Observer = (*WatermarkObserver)(nil)
+
+type WatermarkObserver struct {
+	watermark Watermark
+	lock      sync.RWMutex
+	items     int
+	bytes     int64
+	pressure  bool
+}
+
+func (o *WatermarkObserver) OnEvent(event Event) {
+	o.lock.Lock()
+	switch event.Type {
+	case EventPut:
+		o.bytes += int64(event.Size)
+	case EventGet, EventEvicted:
+		o.bytes -= int64(event.Size)
+	case EventRecovered:
+		o.bytes = int64(event.Size)
+	case EventEmpty:
+		o.bytes = 0
+	}
+	if o.bytes < 0 || event.Len == 0 {
+		o.bytes = 0
+	}
+	o.items = event.Len
+	items, bytes := o.items, o.bytes
+	var callback func(items int, bytes int64)
+	if !o.pressure && o.watermark.high(items, bytes) {
+		o.pressure = true
+		callback = o.watermark.OnHigh
+	} else if o.pressure && o.watermark.low(items, bytes) {
+		o.pressure = false
+		callback = o.watermark.OnLow
+	}
+	o.lock.Unlock()
+	if callback != nil {
+		callback(items, bytes)
+	}
+}
+
+// Pressure 是否处于高压状态，生产者可据此降低写入速度
+func (o *WatermarkObserver) Pressure() bool {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	return o.pressure
+}
+
+// Depth 最近一次事件后的队列条数及数据字节数
+func (o *WatermarkObserver) Depth() (int, int64) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	return o.items, o.bytes
+}
@@ -0,0 +1,124 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWatermarkObserver(t *testing.T) {
+	name := "TestWatermarkObserver"
+	highs, lows := 0, 0
+	observer := NewWatermarkObserver(Watermark{
+		HighItems: 4,
+		LowItems:  2,
+		OnHigh:    func(items int, bytes int64) { highs++ },
+		OnLow:     func(items int, bytes int64) { lows++ },
+	})
+	queue := NewFifoMemoryQueue(10)
+	AddObserver(queue, observer)
+	for i := 0; i < 3; i++ {
+		_ = queue.Put(nil, []byte("data"))
+	}
+	if observer.Pressure() {
+		t.Error(name, "未达到高水位")
+	}
+	_ = queue.Put(nil, []byte("data"))
+	if !observer.Pressure() || highs != 1 {
+		t.Error(name, "达到高水位", highs)
+	}
+	_, _ = queue.Get(nil)
+	_ = queue.Put(nil, []byte("data"))
+	_, _ = queue.Get(nil)
+	if !observer.Pressure() || highs != 1 || lows != 0 {
+		t.Error(name, "高低水位之间保持高压状态", highs, lows)
+	}
+	_, _ = queue.Get(nil)
+	if observer.Pressure() || lows != 1 {
+		t.Error(name, "回落到低水位", lows)
+	}
+	if items, bytes := observer.Depth(); items != 2 || bytes != 8 {
+		t.Error(name, "队列深度", items, bytes)
+	}
+	_ = queue.Close()
+}
+
+func TestWatermarkObserverBytes(t *testing.T) {
+	name := "TestWatermarkObserverBytes"
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		panic(err)
+	}
+	_ = file.Close()
+	defer os.RemoveAll(file.Name())
+	defer os.RemoveAll(diskStateFile(file.Name()))
+	queue, err := NewLifoDiskQueue(file.Name())
+	if err != nil {
+		panic(err)
+	}
+	_ = queue.Put(nil, make([]byte, 100))
+	_ = queue.Put(nil, make([]byte, 100))
+	_ = queue.Close()
+
+	observer := NewWatermarkObserver(Watermark{HighBytes: 200, LowBytes: 100})
+	queue, err = NewLifoDiskQueue(file.Name(), WithObserver(observer))
+	if err != nil {
+		panic(err)
+	}
+	if items, bytes := observer.Depth(); items != 2 || bytes != 200 || !observer.Pressure() {
+		t.Error(name, "恢复后的队列深度", items, bytes)
+	}
+	_, _ = queue.Get(nil)
+	if observer.Pressure() {
+		t.Error(name, "回落到低水位")
+	}
+	_ = queue.Close()
+
+	_ = os.Remove(file.Name())
+	_ = os.Remove(diskStateFile(file.Name()))
+	observer = NewWatermarkObserver(Watermark{HighBytes: 50, LowBytes: 20})
+	queue, err = NewFifoDiskQueue(file.Name(), WithObserver(observer), WithRetention(Retention{MaxItems: 1}))
+	if err != nil {
+		panic(err)
+	}
+	_ = queue.Put(nil, make([]byte, 40))
+	_ = queue.Put(nil, make([]byte, 10))
+	if items, bytes := observer.Depth(); items != 1 || bytes != 10 || observer.Pressure() {
+		t.Error(name, "淘汰后的队列深度", items, bytes)
+	}
+	_ = queue.Close()
+}
+
+func TestWatermarkObserverOrder(t *testing.T) {
+	name := "TestWatermarkObserverOrder"
+	observer := NewWatermarkObserver(Watermark{HighItems: 1, LowItems: 0})
+	queue := NewFifoMemoryQueue(10)
+	// 阻塞 Put 事件的通知，期间另一个 goroutine 取出该数据
+	gate := make(chan struct{})
+	AddObserver(queue, ObserverFunc(func(event Event) {
+		if event.Type == EventPut {
+			<-gate
+		}
+	}))
+	AddObserver(queue, observer)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = queue.Put(nil, []byte("data"))
+	}()
+	time.Sleep(time.Millisecond * 20)
+	go func() {
+		time.Sleep(time.Millisecond * 20)
+		close(gate)
+	}()
+	if data, err := queue.Get(nil); err != nil || string(data) != "data" {
+		t.Error(name, "获取数据", data, err)
+	}
+	<-done
+	// Get 的事件在 Put 之后通知，取空后恢复低水位
+	if items, bytes := observer.Depth(); items != 0 || bytes != 0 || observer.Pressure() {
+		t.Error(name, "事件按顺序通知", items, bytes, observer.Pressure())
+	}
+	_ = queue.Close()
+}